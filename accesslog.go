@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A ResponseWriter that remembers what it sent, for the access log
+type loggedResponse struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (l *loggedResponse) WriteHeader(status int) {
+	if l.status == 0 {
+		l.status = status
+	}
+	l.ResponseWriter.WriteHeader(status)
+}
+
+func (l *loggedResponse) Write(b []byte) (int, error) {
+	if l.status == 0 {
+		l.status = http.StatusOK
+	}
+	n, err := l.ResponseWriter.Write(b)
+	l.size += n
+	return n, err
+}
+
+// Let the live reload websocket take over the connection
+func (l *loggedResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := l.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+	l.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// Open access logs by file, shared by every host writing to them
+var accessLogs = struct {
+	sync.Mutex
+	m map[string]*os.File
+}{m: make(map[string]*os.File)}
+
+// Log each request in common log format to its host's access_log
+// Hosts without one log to the global log, as every request does with -accessLog
+func logAccess(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &loggedResponse{ResponseWriter: w}
+		h.ServeHTTP(lw, r)
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+		line := fmt.Sprintf("%s - - [%s] %q %d %d", r.RemoteAddr,
+			time.Now().Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method+" "+r.URL.RequestURI()+" "+r.Proto, lw.status, lw.size)
+		host := siteHost(r)
+		logged := false
+		if cfg := loadHostConfig(host); len(cfg.AccessLog) > 0 {
+			logged = writeAccessLog(r, host, cfg.AccessLog, line)
+		}
+		if !logged || *accessLog {
+			logRequest(r, line)
+		}
+	})
+}
+
+// Append a line to a host's access log, opening it on first use
+// The log must be inside the host directory, so a host can't write elsewhere
+func writeAccessLog(r *http.Request, host, name, line string) bool {
+	dir, _, err := resolvePath(host)
+	if err != nil {
+		return false
+	}
+	if filepath.IsAbs(name) {
+		logRequest(r, "Access log must be relative to", host+":", name)
+		return false
+	}
+	name = filepath.Join(dir, name)
+	if rel, err := filepath.Rel(dir, name); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		logRequest(r, "Access log must be inside", host+":", name)
+		return false
+	}
+	accessLogs.Lock()
+	defer accessLogs.Unlock()
+	f, ok := accessLogs.m[name]
+	if !ok {
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			logRequest(r, "Couldn't open access log:", err)
+			return false
+		}
+		accessLogs.m[name] = f
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		logRequest(r, "Couldn't write access log:", err)
+		return false
+	}
+	return true
+}
+
+// Check whether a file is an open access log, whose writes aren't content
+// changes for -liveReload
+func isAccessLog(name string) bool {
+	accessLogs.Lock()
+	defer accessLogs.Unlock()
+	_, ok := accessLogs.m[filepath.Clean(name)]
+	return ok
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHostAccessLogs(t *testing.T) {
+	files := map[string]string{
+		"h/wurk.yaml":  "access_log: access.log\n",
+		"h/pub/a.md":   "a",
+		"g/wurk.yaml":  "access_log: logs/g.txt\n",
+		"g/logs/.keep": "",
+		"g/pub/b.md":   "b",
+	}
+	for name, contents := range testTemplates {
+		files["g"+strings.TrimPrefix(name, testHost)] = contents
+	}
+	newSite(t, files)
+	setFlag(t, accessLog, true)
+	global := captureLog(t)
+	h := logAccess(http.HandlerFunc(pageHandler))
+	request(h, http.MethodGet, "/a", nil)
+	r := httptest.NewRequest(http.MethodGet, "/b", nil)
+	r.Host = "g"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	a, _ := os.ReadFile("h/access.log")
+	b, _ := os.ReadFile("g/logs/g.txt")
+	if !strings.Contains(string(a), `"GET /a HTTP/1.1" 200`) || strings.Contains(string(a), "/b") {
+		t.Errorf("h logged %q", a)
+	}
+	if !strings.Contains(string(b), `"GET /b HTTP/1.1" 200`) || strings.Contains(string(b), "/a") {
+		t.Errorf("g logged %q", b)
+	}
+	if !strings.Contains(global.String(), "GET /a") || !strings.Contains(global.String(), "GET /b") {
+		t.Errorf("global log has %q", global)
+	}
+}
+
+func TestAccessLogOutsideHost(t *testing.T) {
+	dir := newSite(t, nil)
+	logged := captureLog(t)
+	for _, name := range []string{"../escaped.log", "logs/../../escaped.log", dir + "/escaped.log"} {
+		if writeAccessLog(nil, testHost, name, "line") {
+			t.Errorf("wrote %s", name)
+		}
+	}
+	if _, err := os.Stat("escaped.log"); err == nil {
+		t.Error("log written outside the host")
+	}
+	if !strings.Contains(logged.String(), "Access log must be") {
+		t.Errorf("rejection not logged: %s", logged)
+	}
+}
+
+func TestAccessLogFallback(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/wurk.yaml": "access_log: access.log\n",
+		"h/pub/a.md":  "a",
+		"g/pub/b.md":  "b",
+	})
+	global := captureLog(t)
+	h := logAccess(http.HandlerFunc(pageHandler))
+	request(h, http.MethodGet, "/a", nil)
+	for _, host := range []string{"g", "made.up"} {
+		r := httptest.NewRequest(http.MethodGet, "/b", nil)
+		r.Host = host
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if strings.Contains(global.String(), "GET /a") {
+		t.Errorf("host with its own log also logged globally: %q", global)
+	}
+	if strings.Count(global.String(), "GET /b") != 2 {
+		t.Errorf("hosts without a log not logged globally: %q", global)
+	}
+	hostConfigs.Lock()
+	_, cached := hostConfigs.m["made.up"]
+	hostConfigs.Unlock()
+	if cached {
+		t.Error("config cached for a host that isn't served")
+	}
+}
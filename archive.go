@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A file going into a zip download, either a rendered page or a file to copy
+type archiveEntry struct {
+	name    string
+	modTime time.Time
+	page    string
+	file    string
+	size    int64
+}
+
+// Send everything served below the directory dir as a zip of the same shape
+// Pages go in rendered, as page.html, and drafts, hidden pages, dot files,
+// ignored files and anything blocked for the client are left out just as they
+// are from listings
+// Directories holding more than -zipMaxFiles files or -zipMaxBytes bytes are
+// turned away before anything is sent
+func serveArchive(w http.ResponseWriter, r *http.Request, dir string) {
+	entries := archiveEntries(r, dir)
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	if len(entries) > *zipMaxFiles || total > *zipMaxBytes {
+		renderError(w, r, http.StatusForbidden, "Too much to download as a zip.")
+		logRequest(r, "zip of", len(entries), "files,", total, "bytes refused")
+		return
+	}
+	name := path.Base(strings.Trim(r.URL.Path, "/"))
+	if name == "." {
+		name = r.Host
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	if r.Method == http.MethodHead {
+		return
+	}
+	// the archive streams out as it's built, so a failure can only be logged
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		if len(e.file) == 0 {
+			if addToArchive(r, zw, e.name, e.modTime, strings.NewReader(e.page)) != nil {
+				break
+			}
+			continue
+		}
+		f, err := os.Open(e.file)
+		if err != nil {
+			logRequest(r, err)
+			continue
+		}
+		err = addToArchive(r, zw, e.name, e.modTime, f)
+		f.Close()
+		if err != nil {
+			break
+		}
+	}
+	if err := zw.Close(); err != nil {
+		logRequest(r, err)
+	}
+}
+
+// Gather what a zip download of dir holds, in walk order
+func archiveEntries(r *http.Request, dir string) []archiveEntry {
+	root := getPubRoot(r)
+	patterns := ignorePatterns(root)
+	blocks := requestBlocks(r)
+	pages := make(map[string]sitePage)
+	for _, p := range sitePages(r) {
+		pages[p.File] = p
+	}
+	var entries []archiveEntry
+	walkRoots(dir, func(p string, d fs.DirEntry) error {
+		if (d.Name()[0] == '.' && p != dir) || ignored(patterns, root, p, d.IsDir()) || blocks.covers(pageURL(root, p)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if trimPageExt(p) != p {
+			page, ok := pages[p]
+			if !ok || !listed(page.Info) {
+				return nil
+			}
+			rel = strings.TrimSuffix(rel, filepath.Ext(rel)) + ".html"
+			entries = append(entries, archiveEntry{name: rel, modTime: page.ModTime, page: page.HTML, size: int64(len(page.HTML))})
+			return nil
+		}
+		filename, st, err := resolvePath(p)
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, archiveEntry{name: rel, modTime: st.ModTime(), file: filename, size: st.Size()})
+		return nil
+	})
+	return entries
+}
+
+// Copy one file into the archive, stopping the walk if the client has gone
+func addToArchive(r *http.Request, zw *zip.Writer, name string, modTime time.Time, src io.Reader) error {
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err == nil {
+		_, err = io.Copy(dst, src)
+	}
+	if err != nil {
+		logRequest(r, err)
+		return err
+	}
+	return nil
+}
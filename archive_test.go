@@ -0,0 +1,76 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/.wurkignore":        "tmp/\n",
+		"h/pub/docs/a.md":      "# A",
+		"h/pub/docs/b.md":      "---\ndraft: true\n---\nb",
+		"h/pub/docs/c.md":      "---\nhidden: true\n---\nc",
+		"h/pub/docs/img.png":   "PNG",
+		"h/pub/docs/.secret":   "s",
+		"h/pub/docs/sub/d.md":  "d",
+		"h/pub/docs/tmp/e.txt": "e",
+		"h/pub/other.md":       "o",
+	})
+	if w := getPage("/docs/?download=zip"); w.Header().Get("Content-Type") == "application/zip" {
+		t.Error("zip sent without -zipDownloads")
+	}
+	setFlag(t, zipDownloads, true)
+	w := getPage("/docs/?download=zip")
+	if ct, cd := w.Header().Get("Content-Type"), w.Header().Get("Content-Disposition"); ct != "application/zip" || cd != "attachment; filename=docs.zip" {
+		t.Errorf("got %q, %q", ct, cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	var names []string
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(contents)
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "a.html img.png sub/d.html" {
+		t.Errorf("zip holds %s", got)
+	}
+	if !strings.Contains(files["a.html"], "<h1") || files["img.png"] != "PNG" {
+		t.Errorf("got %q", files)
+	}
+}
+
+func TestArchiveLimits(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/docs/a.md":    "# A",
+		"h/pub/docs/img.png": "PNG",
+	})
+	setFlag(t, zipDownloads, true)
+	if w := getPage("/docs/?download=zip"); w.Code != http.StatusOK {
+		t.Errorf("zip within limits got status %d", w.Code)
+	}
+	setFlag(t, zipMaxFiles, 1)
+	if w := getPage("/docs/?download=zip"); w.Code != http.StatusForbidden {
+		t.Errorf("zip of too many files got status %d", w.Code)
+	}
+	setFlag(t, zipMaxFiles, 10)
+	setFlag(t, zipMaxBytes, 2)
+	if w := getPage("/docs/?download=zip"); w.Code != http.StatusForbidden {
+		t.Errorf("zip of too many bytes got status %d", w.Code)
+	}
+}
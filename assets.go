@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Serve files from the host's assets directory under -assetsPrefix
+// Assets live outside pub so they stay out of listings, and are cached for long
+func assetHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkDomain(w, r); err != nil {
+		return
+	}
+	rel := path.Clean("/" + strings.TrimPrefix(r.URL.Path, assetsURL()))
+	filename, st, err := resolvePath(filepath.Join(siteHost(r), "assets", filepath.FromSlash(rel)))
+	if err != nil || st.IsDir() {
+		msg := fmt.Sprintf("Could not load %s: File not found", r.URL.Path)
+		renderError(w, r, http.StatusNotFound, msg)
+		return
+	}
+	if typ, ok := mimeType(r, filename); ok {
+		w.Header().Set("Content-Type", typ)
+	}
+	if *assetsMaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(assetsMaxAge.Seconds())))
+	}
+	http.ServeFile(w, r, filename)
+}
+
+// Ask browsers to fetch a page's stylesheets and scripts before they parse it
+func preloadAssets(w http.ResponseWriter, info PageInfo) {
+	for _, css := range info.ExtraCSS {
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=preload; as=style", css))
+	}
+	for _, js := range info.ExtraJS {
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=preload; as=script", js))
+	}
+}
+
+// The URL prefix assets are served under, always with slashes either side
+func assetsURL() string {
+	return path.Join("/", *assetsPrefix) + "/"
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssets(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/assets/css/site.css": "body{}",
+		"h/pub/a.md":            "a",
+	})
+	setFlag(t, assetsMaxAge, time.Hour)
+	h := http.HandlerFunc(assetHandler)
+	w := request(h, http.MethodGet, "/assets/css/site.css", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "body{}" {
+		t.Fatalf("got status %d: %q", w.Code, w.Body.String())
+	}
+	if typ := w.Header().Get("Content-Type"); !strings.HasPrefix(typ, "text/css") {
+		t.Errorf("got Content-Type %q", typ)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Errorf("got Cache-Control %q", cc)
+	}
+	for _, target := range []string{"/assets/css/", "/assets/../pub/a.md"} {
+		if w := request(h, http.MethodGet, target, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s got status %d", target, w.Code)
+		}
+	}
+	if body := getPage("/").Body.String(); strings.Contains(body, "site.css") || strings.Contains(body, "assets") {
+		t.Errorf("assets listed in pub: %s", body)
+	}
+}
+
+func TestPreloadHeaders(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/d/a.md": "---\ncss: [/assets/a.css, b.css]\njs: [x.js]\n---\na",
+	})
+	got := getPage("/d/a").Header().Values("Link")
+	want := []string{
+		"<http://h/assets/a.css>; rel=preload; as=style",
+		"<http://h/d/b.css>; rel=preload; as=style",
+		"<http://h/d/x.js>; rel=preload; as=script",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got Link %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strconv"
+)
+
+// Get the user a request's basic auth credentials sign it in as
+// Credentials are checked against the bcrypt hashes of the users in the
+// host's wurk.yaml, and requests without them, or with wrong ones, are
+// simply anonymous
+func requestUser(r *http.Request) (string, bool) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	hash, ok := loadHostConfig(siteHost(r)).Users[name]
+	if !ok {
+		return "", false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// Ask for basic auth credentials, which browsers only send once challenged
+// Pages ask on ?login=1 until the reader signs in
+func challengeLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Basic realm="+strconv.Quote(r.Host)+`, charset="UTF-8"`)
+	renderError(w, r, http.StatusUnauthorized, "Sign in to see this page.")
+}
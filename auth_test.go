@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/base64"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticated(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSite(t, map[string]string{
+		"h/wurk.yaml":             "users:\n  ann: " + string(hash) + "\n",
+		"h/templates/header.html": "{{if .Authenticated}}hi {{.User}}{{else}}anon{{end}}|",
+		"h/pub/a.md":              "a",
+	})
+	basic := func(user, password string) map[string]string {
+		return map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))}
+	}
+	h := http.HandlerFunc(pageHandler)
+	for _, c := range []struct {
+		name, target string
+		header       map[string]string
+		code         int
+		who          string
+	}{
+		{"anonymous", "/a", nil, http.StatusOK, "anon|"},
+		{"signed in", "/a", basic("ann", "s3cret"), http.StatusOK, "hi ann|"},
+		{"wrong password", "/a", basic("ann", "nope"), http.StatusOK, "anon|"},
+		{"unknown user", "/a", basic("bob", "s3cret"), http.StatusOK, "anon|"},
+		{"the hash as password", "/a", basic("ann", string(hash)), http.StatusOK, "anon|"},
+		{"login signed in", "/a?login=1", basic("ann", "s3cret"), http.StatusOK, "hi ann|"},
+		{"login anonymous", "/a?login=1", nil, http.StatusUnauthorized, ""},
+		{"login wrong password", "/a?login=1", basic("ann", "nope"), http.StatusUnauthorized, ""},
+	} {
+		w := request(h, "GET", c.target, c.header)
+		if w.Code != c.code {
+			t.Errorf("%s got %d, want %d", c.name, w.Code, c.code)
+		}
+		if c.code == http.StatusUnauthorized {
+			if !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), `Basic realm="h"`) {
+				t.Errorf("%s challenged with %q", c.name, w.Header().Get("WWW-Authenticate"))
+			}
+			continue
+		}
+		if body := w.Body.String(); !strings.HasPrefix(body, c.who) {
+			t.Errorf("%s got %q, want it to start %q", c.name, body, c.who)
+		}
+		if !strings.Contains(strings.Join(w.Header()["Vary"], ","), "Authorization") {
+			t.Errorf("%s doesn't vary on Authorization", c.name)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A path the host can't serve, everywhere or to clients in some countries
+type block struct {
+	pattern   string
+	countries []string
+}
+
+// Read the host's blocked.txt, which holds a path glob per line followed by
+// the country codes it's blocked in, or by nothing to block it everywhere:
+//
+//	/reports/2019.md
+//	/news/* DE FR
+//
+// A pattern ending in / blocks everything below it
+func hostBlocks(host string) []block {
+	contents, err := readFile(filepath.Join(host, "blocked.txt"))
+	if err != nil {
+		return nil
+	}
+	var blocks []block
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		b := block{pattern: fields[0]}
+		for _, c := range fields[1:] {
+			b.countries = append(b.countries, strings.ToUpper(c))
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// Check whether a block covers a URL path for a client in country,
+// which is empty when the client's country isn't known
+func (b block) covers(p, country string) bool {
+	if strings.HasSuffix(b.pattern, "/") {
+		if !strings.HasPrefix(p+"/", b.pattern) {
+			return false
+		}
+	} else if ok, _ := path.Match(b.pattern, p); !ok {
+		return false
+	}
+	if len(b.countries) == 0 {
+		return true
+	}
+	for _, c := range b.countries {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
+
+// The blocks in a host's blocked.txt that apply to one client
+type clientBlocks struct {
+	blocks  []block
+	country string
+}
+
+// Get the blocks for a request's client, who is placed in a country by the
+// -countryHeader their proxy sets
+// Every route that sends pages, alone or gathered into listings, feeds,
+// indexes and archives, checks them, so a blocked page never leaves the server
+func requestBlocks(r *http.Request) clientBlocks {
+	return clientBlocks{blocks: hostBlocks(siteHost(r)), country: clientCountry(r)}
+}
+
+// Get the client's country code, or nothing if the proxy didn't say
+func clientCountry(r *http.Request) string {
+	return strings.ToUpper(strings.TrimSpace(r.Header.Get(*countryHeader)))
+}
+
+// Get the client's country if blocked.txt has rules for it, or nothing
+// Caches of what clients may see are split by this, so every other
+// country, and any made up one, shares a single entry
+func (cb clientBlocks) cacheCountry() string {
+	for _, b := range cb.blocks {
+		for _, c := range b.countries {
+			if c == cb.country {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+// Check whether the client is blocked from the URL path p
+func (cb clientBlocks) covers(p string) bool {
+	if len(cb.blocks) == 0 {
+		return false
+	}
+	p = path.Clean("/" + p)
+	// /report.md renders the same page as /report
+	page := p
+	for _, ext := range pageExts() {
+		page = strings.TrimSuffix(page, ext)
+	}
+	for _, b := range cb.blocks {
+		if b.covers(p, cb.country) || b.covers(page, cb.country) {
+			return true
+		}
+	}
+	return false
+}
+
+// Answer requests for paths in the host's blocked.txt with a 451 through
+// the site's 451.html template
+func withBlocks(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestBlocks(r).covers(r.URL.Path) {
+			blockedPage(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func blockedPage(w http.ResponseWriter, r *http.Request) {
+	renderError(w, r, http.StatusUnavailableForLegalReasons, "This page is unavailable for legal reasons.")
+}
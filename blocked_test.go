@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBlocked(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/blocked.txt":         "# court orders\n/reports/2019\n/news/ de fr\n/old/*\n/p\n",
+		"h/templates/451.html":  "<main>{{.Page}}</main>",
+		"h/pub/reports/2019.md": "r",
+		"h/pub/reports/2020.md": "r",
+		"h/pub/news/a.md":       "n",
+		"h/pub/old/x.md":        "o",
+		"h/pub/p.md":            "---\npermalink: /elsewhere\n---\np",
+	})
+	h := withBlocks(http.HandlerFunc(pageHandler))
+	for _, c := range []struct {
+		target, country string
+		code            int
+	}{
+		{"/reports/2019", "", http.StatusUnavailableForLegalReasons},
+		{"/reports/2019.md", "", http.StatusUnavailableForLegalReasons},
+		{"/reports/2020", "", http.StatusOK},
+		{"/news/a", "DE", http.StatusUnavailableForLegalReasons},
+		{"/news/a", "fr", http.StatusUnavailableForLegalReasons},
+		{"/news/", "DE", http.StatusUnavailableForLegalReasons},
+		{"/news/a", "US", http.StatusOK},
+		{"/news/a", "", http.StatusOK},
+		{"/old/x", "", http.StatusUnavailableForLegalReasons},
+		{"/elsewhere", "", http.StatusUnavailableForLegalReasons},
+	} {
+		w := request(h, "GET", c.target, map[string]string{"CF-IPCountry": c.country})
+		if w.Code != c.code {
+			t.Errorf("%s from %q got %d, want %d", c.target, c.country, w.Code, c.code)
+		}
+		if c.code == http.StatusUnavailableForLegalReasons && !strings.HasPrefix(w.Body.String(), "<main>") {
+			t.Errorf("%s got %q, not the 451 template", c.target, w.Body.String())
+		}
+	}
+}
+
+// A page blocked for a country doesn't reach its clients any other way,
+// and the caches shared between countries don't carry it across
+func TestBlockedAggregates(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/blocked.txt":           "/news/secret DE\n",
+		"h/templates/footer.html": "<f>{{range .Recent}}[{{.Title}}]{{end}}{{range .Featured}}[{{.Title}}]{{end}}{{range .Tree}}[{{.Title}}{{range .Children}}({{.Title}}){{end}}]{{end}}</f>",
+		"h/templates/404.html":    "{{range .Suggestions}}[{{.Title}}]{{end}}",
+		"h/pub/news/secret.md":    "---\ntitle: Secret\ndate: 2024-02-01\nfeatured: true\n---\nclassified",
+		"h/pub/news/open.md":      "---\ntitle: Open\ndate: 2024-01-01\n---\npublic",
+		"h/pub/other.md":          "o",
+	})
+	setFlag(t, dirSummaries, true)
+	setFlag(t, treeDepth, 2)
+	setFlag(t, zipDownloads, true)
+	captureLog(t)
+	pages := http.HandlerFunc(pageHandler)
+	routes := []struct {
+		name   string
+		h      http.Handler
+		target string
+		accept string
+	}{
+		{"listing", pages, "/news/", ""},
+		{"combined", pages, "/news/?combine=1", ""},
+		{"zip", pages, "/news/?download=zip", ""},
+		{"rss", pages, "/news/feed.xml", ""},
+		{"json feed", pages, "/news/feed.json", ""},
+		{"atom", pages, "/news/", "application/atom+xml"},
+		{"sitemap", pages, "/sitemap.xml", ""},
+		{"widgets", pages, "/other", ""},
+		{"suggestions", pages, "/news/secrt", ""},
+		{"recent", http.HandlerFunc(recentFeedHandler), "/recent.xml", ""},
+		{"search", http.HandlerFunc(searchIndexHandler), "/search-index.json", ""},
+		{"manifest", http.HandlerFunc(manifestHandler), "/manifest.json", ""},
+	}
+	leaks := func(country string, route int) bool {
+		c := routes[route]
+		body := request(c.h, "GET", c.target, map[string]string{"CF-IPCountry": country, "Accept": c.accept}).Body.Bytes()
+		if c.name == "zip" {
+			zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, f := range zr.File {
+				names = append(names, f.Name)
+			}
+			body = []byte(strings.Join(names, " "))
+		}
+		return bytes.Contains(bytes.ToLower(body), []byte("secret")) || bytes.Contains(body, []byte("classified"))
+	}
+	// the first client's view is cached, the second mustn't be given it
+	for _, order := range [][]string{{"US", "DE"}, {"DE", "US"}} {
+		resetCaches()
+		for i, c := range routes {
+			for _, country := range order {
+				if leaks(country, i) != (country == "US") {
+					t.Errorf("%s for %s after %s: shown %t", c.name, country, order[0], country == "DE")
+				}
+			}
+		}
+	}
+}
+
+// Made up countries share the cache entries of countries without rules
+func TestBlockedCacheKeys(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/blocked.txt":        "/news/secret DE\n/old/\n",
+		"h/pub/news/secret.md": "s",
+		"h/pub/news/open.md":   "o",
+	})
+	setFlag(t, treeDepth, 2)
+	for _, country := range []string{"", "US", "FR", "DE", "de", "XX", "<script>"} {
+		request(http.HandlerFunc(pageHandler), "GET", "/", map[string]string{"CF-IPCountry": country})
+	}
+	trees.Lock()
+	nTrees := len(trees.m)
+	trees.Unlock()
+	childCounts.Lock()
+	nCounts := len(childCounts.m)
+	childCounts.Unlock()
+	// one for DE and one for everyone else
+	if nTrees != 2 || nCounts != 2 {
+		t.Errorf("%d trees and %d child counts cached, want 2 of each", nTrees, nCounts)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Serve the assets named in ?files= joined into one minified file
+// /bundle.css?files=base,theme sends assets/base.css then assets/theme.css
+func bundleHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkDomain(w, r); err != nil {
+		return
+	}
+	ext := path.Ext(r.URL.Path)
+	var files []string
+	var modTime time.Time
+	keyParts := []string{"bundle", ext}
+	for _, name := range strings.Split(r.URL.Query().Get("files"), ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if path.Ext(name) == "" {
+			name += ext
+		}
+		rel := path.Clean("/" + name)
+		filename, st, err := resolvePath(filepath.Join(siteHost(r), "assets", filepath.FromSlash(rel)))
+		if path.Ext(rel) != ext || err != nil || st.IsDir() {
+			msg := fmt.Sprintf("Could not bundle %s: File not found", name)
+			renderError(w, r, http.StatusNotFound, msg)
+			return
+		}
+		if st.ModTime().After(modTime) {
+			modTime = st.ModTime()
+		}
+		files = append(files, filename)
+		keyParts = append(keyParts, filename, st.ModTime().String())
+	}
+	if len(files) == 0 {
+		renderError(w, r, http.StatusBadRequest, "No files to bundle.")
+		return
+	}
+	key := cacheKey(keyParts...)
+	out, ok := cacheGet(key)
+	if !ok {
+		var buf bytes.Buffer
+		for _, filename := range files {
+			contents, err := os.ReadFile(filename)
+			if err != nil {
+				renderError(w, r, http.StatusInternalServerError, "Could not build bundle.")
+				logRequest(r, err)
+				return
+			}
+			if ext == ".css" {
+				buf.Write(minifyCSS(contents))
+			} else {
+				// a file missing its last semicolon or ending in a comment
+				// mustn't run into the next
+				buf.Write(minifyJS(contents))
+				buf.WriteString("\n;")
+			}
+			buf.WriteString("\n")
+		}
+		out = buf.Bytes()
+		cachePut(r, key, out)
+	}
+	sum := sha256.Sum256(out)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	if *assetsMaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(assetsMaxAge.Seconds())))
+	}
+	http.ServeContent(w, r, path.Base(r.URL.Path), modTime, bytes.NewReader(out))
+}
+
+// Strip comments and needless whitespace from CSS, leaving strings alone
+func minifyCSS(css []byte) []byte {
+	var out []byte
+	space := false
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := bytes.Index(css[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+			continue
+		case c == '"' || c == '\'':
+			start := i
+			for i++; i < len(css) && css[i] != c; i++ {
+				if css[i] == '\\' {
+					i++
+				}
+			}
+			if space && len(out) > 0 && !strings.ContainsRune("{};,:", rune(out[len(out)-1])) {
+				out = append(out, ' ')
+			}
+			space = false
+			out = append(out, css[start:min(i+1, len(css))]...)
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+			continue
+		}
+		if c == '}' && len(out) > 0 && out[len(out)-1] == ';' {
+			out = out[:len(out)-1]
+		}
+		if space && len(out) > 0 && !strings.ContainsRune("{};,:", rune(out[len(out)-1])) && !strings.ContainsRune("{};,", rune(c)) {
+			out = append(out, ' ')
+		}
+		space = false
+		out = append(out, c)
+	}
+	return out
+}
+
+// Trim indentation and blank lines from JavaScript
+// Anything cleverer would need a parser to know what is a string or a regexp
+func minifyJS(js []byte) []byte {
+	var out []byte
+	for _, line := range bytes.Split(js, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if len(out) > 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, line...)
+	}
+	return out
+}
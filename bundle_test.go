@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/assets/a.css":     "/* base */\nbody {\n  color: red;\n  font-family: \"Open  Sans\", serif;\n}\n\na :hover { margin: 0 auto; }\n",
+		"h/assets/sub/b.css": "p{width:calc(100% - 2px)}",
+		"h/assets/x.js":      "x",
+		"h/secret.css":       "secret",
+	})
+	h := http.HandlerFunc(bundleHandler)
+	w := request(h, "GET", "/bundle.css?files=a,sub/b.css", nil)
+	want := "body{color:red;font-family:\"Open  Sans\",serif}a :hover{margin:0 auto}\np{width:calc(100% - 2px)}\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("got %d %q, want %q", w.Code, w.Body.String(), want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/css; charset=utf-8" {
+		t.Errorf("Content-Type %q", ct)
+	}
+	for target, code := range map[string]int{
+		"/bundle.css?files=../secret": http.StatusNotFound,
+		"/bundle.css?files=x.js":      http.StatusNotFound,
+		"/bundle.css":                 http.StatusBadRequest,
+	} {
+		if w := request(h, "GET", target, nil); w.Code != code {
+			t.Errorf("%s got %d, want %d", target, w.Code, code)
+		}
+	}
+}
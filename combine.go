@@ -0,0 +1,36 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	urlpath "path"
+	"path/filepath"
+	"strings"
+)
+
+// Render the pages of a directory listing one after another, each under
+// its title, so a whole section can be read or printed in one go
+// Directories in the listing, and pages blocked for the client, are left out
+func combinedPages(r *http.Request, path string, links []Link) template.HTML {
+	var b strings.Builder
+	loc := siteLocation(r, siteHost(r))
+	blocks := requestBlocks(r)
+	for _, l := range links {
+		if strings.HasSuffix(l.Path, "/") || blocks.covers(l.Path) {
+			continue
+		}
+		page, f, err := loadPage(r, filepath.Join(path, urlpath.Base(l.Path)))
+		if err != nil {
+			logRequest(r, err)
+			continue
+		}
+		title := NewPageInfo(r, f, loc).Title
+		if len(title) == 0 {
+			title = l.Title
+		}
+		b.WriteString("<section>\n<h2>" + template.HTMLEscapeString(title) + "</h2>\n")
+		b.WriteString(string(page))
+		b.WriteString("</section>\n")
+	}
+	return template.HTML(b.String())
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCombine(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/docs/_index.md":  "---\nper: 1\n---\nIntro",
+		"h/pub/docs/1-start.md": "---\ntitle: Getting <Started>\n---\nFirst",
+		"h/pub/docs/2-next.md":  "Second",
+		"h/pub/docs/3-draft.md": "---\ndraft: true\n---\nDraft",
+		"h/pub/docs/sub/x.md":   "Sub",
+	})
+	start := "<section>\n<h2>Getting &lt;Started&gt;</h2>\n<p>First</p>\n</section>\n"
+	next := "<section>\n<h2>2 Next</h2>\n<p>Second</p>\n</section>\n"
+	for target, want := range map[string]string{
+		"/docs/?combine=1":                      "<h>Docs</h><v><p>Intro</p>\n" + start + next + "</v><f></f>",
+		"/docs/?combine=1&sort=name&order=desc": "<h>Docs</h><v><p>Intro</p>\n" + next + start + "</v><f></f>",
+	} {
+		if body := getPage(target).Body.String(); body != want {
+			t.Errorf("%s got %q, want %q", target, body, want)
+		}
+	}
+	if body := getPage("/docs/").Body.String(); strings.Contains(body, "<section>") {
+		t.Errorf("listing without ?combine got %q", body)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Check whether the client lists an encoding in Accept-Encoding without q=0
+func acceptsEncoding(r *http.Request, enc string) bool {
+	return headerAccepts(r.Header.Get("Accept-Encoding"), enc)
+}
+
+// Check whether an Accept style header lists value without q=0
+func headerAccepts(header, value string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), value) {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// Pick the encoding to compress a response with, preferring brotli to gzip
+// An empty string means the response goes out uncompressed
+func negotiateEncoding(r *http.Request) string {
+	if !*compress {
+		return ""
+	}
+	for _, enc := range []string{"br", "gzip"} {
+		if acceptsEncoding(r, enc) {
+			return enc
+		}
+	}
+	return ""
+}
+
+// Compress body into buf with the given encoding
+func compressTo(buf *bytes.Buffer, body []byte, encoding string) error {
+	var zw io.WriteCloser
+	switch encoding {
+	case "br":
+		zw = brotli.NewWriter(buf)
+	case "gzip":
+		zw = gzip.NewWriter(buf)
+	default:
+		_, err := buf.Write(body)
+		return err
+	}
+	if _, err := zw.Write(body); err != nil {
+		return err
+	}
+	return zw.Close()
+}
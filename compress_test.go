@@ -0,0 +1,75 @@
+package main
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEncodingETags(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "hi"})
+	setFlag(t, compress, true)
+	plain := getPage("/a")
+	gz := request(http.HandlerFunc(pageHandler), http.MethodGet, "/a", map[string]string{"Accept-Encoding": "gzip"})
+	if gz.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got Content-Encoding %q", gz.Header().Get("Content-Encoding"))
+	}
+	if a, b := plain.Header().Get("ETag"), gz.Header().Get("ETag"); a == b || len(a) == 0 {
+		t.Errorf("identity ETag %s, gzip ETag %s", a, b)
+	}
+	if !slices.Contains(gz.Header().Values("Vary"), "Accept-Encoding") {
+		t.Errorf("got Vary %q", gz.Header().Values("Vary"))
+	}
+	zr, err := gzip.NewReader(gz.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := io.ReadAll(zr)
+	if string(out) != plain.Body.String() {
+		t.Errorf("gzip body %q, identity body %q", out, plain.Body.String())
+	}
+	// the gzip ETag doesn't validate the identity response
+	w := request(http.HandlerFunc(pageHandler), http.MethodGet, "/a", map[string]string{"If-None-Match": gz.Header().Get("ETag")})
+	if w.Code != http.StatusOK {
+		t.Errorf("identity request with the gzip ETag got status %d", w.Code)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for accept, want := range map[string]string{
+		"gzip, br":       "br",
+		"br;q=0.5, gzip": "br",
+		"gzip":           "gzip",
+		"br;q=0, gzip":   "gzip",
+		"identity":       "",
+		"":               "",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", accept)
+		if got := negotiateEncoding(r); got != want {
+			t.Errorf("Accept-Encoding %q got %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestBrotli(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "hi"})
+	setFlag(t, compress, true)
+	plain := getPage("/a")
+	w := request(http.HandlerFunc(pageHandler), http.MethodGet, "/a", map[string]string{"Accept-Encoding": "gzip, br"})
+	if w.Header().Get("Content-Encoding") != "br" {
+		t.Fatalf("got Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+	if !strings.HasSuffix(w.Header().Get("ETag"), `-br"`) {
+		t.Errorf("got ETag %s", w.Header().Get("ETag"))
+	}
+	out, err := io.ReadAll(brotli.NewReader(w.Body))
+	if err != nil || string(out) != plain.Body.String() {
+		t.Errorf("brotli body %q (%v), identity body %q", out, err, plain.Body.String())
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Serializes writes and eviction in -cacheDir
+var diskCacheLock sync.Mutex
+
+// Name a cache entry after everything that went into making it
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Name a cached response after the request's host, path and query
+// The query's parameters are sorted, so ?a=1&b=2 and ?b=2&a=1 share an entry
+// while any other query gets its own
+func responseKey(r *http.Request, parts ...string) string {
+	return cacheKey(append([]string{"response", r.Host, r.URL.Path, r.URL.Query().Encode()}, parts...)...)
+}
+
+// Get an entry from -cacheDir, marking it recently used
+func cacheGet(key string) ([]byte, bool) {
+	if len(*cacheDir) == 0 || *noCache {
+		return nil, false
+	}
+	p := filepath.Join(*cacheDir, key)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return data, true
+}
+
+// Store an entry in -cacheDir, evicting the least recently used
+// entries once the directory outgrows -cacheSize
+func cachePut(r *http.Request, key string, data []byte) {
+	if len(*cacheDir) == 0 {
+		return
+	}
+	diskCacheLock.Lock()
+	defer diskCacheLock.Unlock()
+	if err := os.MkdirAll(*cacheDir, 0755); err != nil {
+		logRequest(r, "Couldn't create cache:", err)
+		return
+	}
+	tmp, err := os.CreateTemp(*cacheDir, ".tmp-")
+	if err != nil {
+		logRequest(r, "Couldn't write cache:", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(*cacheDir, key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logRequest(r, "Couldn't write cache:", err)
+		return
+	}
+	evictCache(r)
+}
+
+func evictCache(r *http.Request) {
+	entries, err := os.ReadDir(*cacheDir)
+	if err != nil {
+		return
+	}
+	var infos []os.FileInfo
+	var total int64
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+			infos = append(infos, info)
+			total += info.Size()
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		if total <= *cacheSize {
+			return
+		}
+		if err := os.Remove(filepath.Join(*cacheDir, info.Name())); err != nil {
+			logRequest(r, "Couldn't evict cache:", err)
+			continue
+		}
+		total -= info.Size()
+	}
+}
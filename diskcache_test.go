@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.png": testImage(t, "png", 800, 400)})
+	setFlag(t, cacheDir, "cache")
+	setFlag(t, thumbWidth, 100)
+	getPage("/a.png?w=100")
+	entries, err := os.ReadDir("cache")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("cache holds %d entries: %v", len(entries), err)
+	}
+	// the second request is answered from the cache, not by resizing again
+	entry := filepath.Join("cache", entries[0].Name())
+	if err := os.WriteFile(entry, []byte("cached"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if body := getPage("/a.png?w=100").Body.String(); body != "cached" {
+		t.Errorf("got %d bytes, not the cached entry", len(body))
+	}
+	if entries, _ := os.ReadDir("cache"); len(entries) != 1 {
+		t.Errorf("cache holds %d entries after a hit", len(entries))
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	newSite(t, nil)
+	setFlag(t, cacheDir, "cache")
+	setFlag(t, cacheSize, 10)
+	cachePut(nil, "old", []byte("123456"))
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join("cache", "old"), past, past)
+	cachePut(nil, "new", []byte("123456"))
+	if _, ok := cacheGet("old"); ok {
+		t.Error("least recently used entry kept")
+	}
+	if data, ok := cacheGet("new"); !ok || string(data) != "123456" {
+		t.Errorf("newest entry got %q", data)
+	}
+}
+
+// Responses are cached by query, whatever order its parameters come in
+func TestResponseKeys(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a", "h/pub/b.md": "b"})
+	setFlag(t, cacheDir, "cache")
+	gzip := map[string]string{"Accept-Encoding": "gzip"}
+	h := http.HandlerFunc(pageHandler)
+	first := request(h, "GET", "/?sort=title&order=desc", gzip).Body.String()
+	if second := request(h, "GET", "/?order=desc&sort=title", gzip).Body.String(); second != first {
+		t.Error("reordered query got a different response")
+	}
+	if entries, _ := os.ReadDir("cache"); len(entries) != 1 {
+		t.Errorf("cache holds %d entries after one query in two orders", len(entries))
+	}
+	if other := request(h, "GET", "/?sort=title", gzip).Body.String(); other == first {
+		t.Error("different queries got the same response")
+	}
+	if entries, _ := os.ReadDir("cache"); len(entries) != 2 {
+		t.Errorf("cache holds %d entries after two queries", len(entries))
+	}
+
+	a := httptest.NewRequest("GET", "/?b=2&a=1", nil)
+	b := httptest.NewRequest("GET", "/?a=1&b=2", nil)
+	c := httptest.NewRequest("GET", "/?a=1&b=3", nil)
+	if responseKey(a) != responseKey(b) || responseKey(a) == responseKey(c) {
+		t.Error("response keys don't follow the sorted query")
+	}
+}
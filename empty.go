@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// What -emptyPages can do with a page that is nothing but front matter
+var emptyPageModes = map[string]bool{"render": true, "404": true, "placeholder": true, "meta": true}
+
+// Deal with a page whose body rendered to nothing, per -emptyPages:
+// render leaves it be, 404 hides it, placeholder shows -emptyPlaceholder
+// and meta lists its front matter instead
+// Returns false if the page was hidden and an error has been sent
+func fillEmptyPage(w http.ResponseWriter, r *http.Request, info *PageInfo, f map[string]interface{}) bool {
+	if len(strings.TrimSpace(string(info.Page))) > 0 {
+		return true
+	}
+	switch *emptyPages {
+	case "404":
+		msg := fmt.Sprintf("Could not load %s: File not found", r.URL.Path)
+		renderError(w, r, http.StatusNotFound, msg)
+		logRequest(r, r.URL.Path+": empty page")
+		return false
+	case "placeholder":
+		info.Page = template.HTML("<p>" + template.HTMLEscapeString(*emptyPlaceholder) + "</p>")
+	case "meta":
+		info.Page = frontMatterList(f)
+	}
+	return true
+}
+
+// Show front matter as a definition list, keys in order
+func frontMatterList(f map[string]interface{}) template.HTML {
+	var keys []string
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("<dl>\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "<dt>%s</dt><dd>%s</dd>\n",
+			template.HTMLEscapeString(k), template.HTMLEscapeString(fmt.Sprint(f[k])))
+	}
+	b.WriteString("</dl>\n")
+	return template.HTML(b.String())
+}
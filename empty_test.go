@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEmptyPages(t *testing.T) {
+	for mode, want := range map[string]string{
+		"render":      "<h>Empty</h><v></v><f></f>",
+		"placeholder": "<h>Empty</h><v><p>Nothing here yet.</p></v><f></f>",
+		"meta":        "<h>Empty</h><v><dl>\n<dt>tags</dt><dd>[go]</dd>\n<dt>title</dt><dd>Empty</dd>\n</dl>\n</v><f></f>",
+	} {
+		newSite(t, map[string]string{
+			"h/pub/e.md": "---\ntitle: Empty\ntags: [go]\n---\n\n",
+			"h/pub/f.md": "---\ntitle: Full\n---\nfull",
+		})
+		setFlag(t, emptyPages, mode)
+		if w := getPage("/e"); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("-emptyPages=%s got %d %q, want %q", mode, w.Code, w.Body.String(), want)
+		}
+		if body := getPage("/f").Body.String(); body != "<h>Full</h><v><p>full</p>\n</v><f></f>" {
+			t.Errorf("-emptyPages=%s changed a page with a body: %q", mode, body)
+		}
+	}
+	setFlag(t, emptyPages, "404")
+	logged := captureLog(t)
+	if w := getPage("/e"); w.Code != http.StatusNotFound {
+		t.Errorf("-emptyPages=404 got %d", w.Code)
+	}
+	if !strings.Contains(logged.String(), "/e: empty page") {
+		t.Errorf("empty page not logged: %q", logged)
+	}
+	setFlag(t, emptyPlaceholder, "Soon.")
+	setFlag(t, emptyPages, "placeholder")
+	if body := getPage("/e").Body.String(); body != "<h>Empty</h><v><p>Soon.</p></v><f></f>" {
+		t.Errorf("-emptyPlaceholder got %q", body)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+// Send an error through the site's <status>.html template if it has one
+// Server errors without their own template share 500.html
+// If that fails too the error goes out as plain text, never another error page
+func renderError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	tmpl := strconv.Itoa(status)
+	if status >= 500 && !templateExists(r, tmpl) {
+		tmpl = "500"
+	}
+	if !templateExists(r, tmpl) {
+		http.Error(w, msg, status)
+		return
+	}
+	info := NewPageInfo(r, nil, siteLocation(r, siteHost(r)))
+	info.Title = http.StatusText(status)
+	info.BreadCrumb = breadCrumb(r.URL.Path)
+	info.Status = status
+	info.Page = template.HTML(template.HTMLEscapeString(msg))
+	if status == http.StatusNotFound {
+		info.Suggestions = suggestPages(r)
+	}
+	mountLinks(r, &info)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := renderTemplate(buf, r, tmpl, info); err != nil {
+		logRequest(r, err)
+		http.Error(w, msg, status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+}
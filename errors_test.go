@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestThemedServerError(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/view.html": "{{.Nope}}",
+		"h/templates/500.html":  "<e>{{.Status}} {{.Title}}: {{.Page}}</e>",
+		"h/pub/a.md":            "a",
+	})
+	captureLog(t)
+	w := getPage("/a")
+	if want := "<e>500 Internal Server Error: Could not load templates.</e>"; w.Code != http.StatusInternalServerError || w.Body.String() != want {
+		t.Errorf("got status %d: %q, want %q", w.Code, w.Body.String(), want)
+	}
+}
+
+func TestBrokenServerErrorPage(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/view.html": "{{.Nope}}",
+		"h/templates/500.html":  "{{.Nope}}",
+		"h/pub/a.md":            "a",
+	})
+	captureLog(t)
+	w := getPage("/a")
+	if w.Code != http.StatusInternalServerError || strings.TrimSpace(w.Body.String()) != "Could not load templates." {
+		t.Errorf("got status %d: %q", w.Code, w.Body.String())
+	}
+}
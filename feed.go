@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A directory's feed settings along with its newest pages
+type feed struct {
+	Title       string
+	Description string
+	URL         string
+	Items       []sitePage
+}
+
+// Gather the newest published pages below the directory URL dir
+// The directory's _index can set a title, description and limit under a feed key
+func collectFeed(r *http.Request, dir string) feed {
+	fd := feed{
+		Title: dirTitle(r, dir),
+		URL:   dir,
+	}
+	limit := *feedLimit
+	if f, ok := readFrontMatter(r, filepath.Join(getPubRoot(r), dir, "_index")); ok {
+		if t, ok := f["title"].(string); ok {
+			fd.Title = t
+		}
+		if d, ok := f["description"].(string); ok {
+			fd.Description = d
+		}
+		if cfg, ok := f["feed"].(map[interface{}]interface{}); ok {
+			if t, ok := cfg["title"].(string); ok {
+				fd.Title = t
+			}
+			if d, ok := cfg["description"].(string); ok {
+				fd.Description = d
+			}
+			if l, ok := cfg["limit"].(int); ok {
+				limit = l
+			}
+		}
+	}
+	fd.Items = newestPages(r, dir, limit)
+	return fd
+}
+
+// Get up to limit published pages below the directory URL dir, newest first
+func newestPages(r *http.Request, dir string, limit int) []sitePage {
+	var pages []sitePage
+	for _, p := range sitePages(r) {
+		if p.URL == dir || !strings.HasPrefix(p.URL, dir) || !listed(p.Info) {
+			continue
+		}
+		pages = append(pages, p)
+	}
+	sort.SliceStable(pages, func(i, j int) bool {
+		return pages[i].Date.After(pages[j].Date)
+	})
+	if limit > 0 && len(pages) > limit {
+		pages = pages[:limit]
+	}
+	return pages
+}
+
+// The newest pages from every directory of the site
+func collectRecent(r *http.Request) feed {
+	return feed{
+		Title: "Recent updates to " + r.Host,
+		URL:   "/recent",
+		Items: newestPages(r, "/", *recentLimit),
+	}
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+// Serve an RSS feed for the directory holding feed.xml
+func feedHandler(w http.ResponseWriter, r *http.Request) {
+	dir := strings.TrimSuffix(r.URL.Path, "feed.xml")
+	writeRSS(w, r, collectFeed(r, dir))
+}
+
+// Serve the site's newest pages as RSS
+func recentFeedHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkDomain(w, r); err != nil {
+		return
+	}
+	writeRSS(w, r, collectRecent(r))
+}
+
+// List the site's newest pages
+func recentHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkDomain(w, r); err != nil {
+		return
+	}
+	fd := collectRecent(r)
+	info := NewPageInfo(r, nil, siteLocation(r, siteHost(r)))
+	info.Title = fd.Title
+	info.BreadCrumb = breadCrumb(r.URL.Path)
+	for _, p := range fd.Items {
+		info.Dir = append(info.Dir, Link{Title: pageTitle(p), Path: p.URL, Date: p.Date})
+	}
+	setCacheControl(w, r, nil)
+	writePage(w, r, info, "header", "dir", "footer")
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	DatePublished string           `json:"date_published"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name   string `json:"name"`
+	URL    string `json:"url,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// Serve a JSON Feed for the directory holding feed.json
+func jsonFeedHandler(w http.ResponseWriter, r *http.Request) {
+	dir := strings.TrimSuffix(r.URL.Path, "feed.json")
+	fd := collectFeed(r, dir)
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       fd.Title,
+		HomePageURL: absURL(r, fd.URL),
+		FeedURL:     absURL(r, r.URL.Path),
+		Description: fd.Description,
+		Items:       []jsonFeedItem{},
+	}
+	for _, p := range fd.Items {
+		item := jsonFeedItem{
+			ID:            absURL(r, p.URL),
+			URL:           absURL(r, p.URL),
+			Title:         pageTitle(p),
+			ContentHTML:   p.HTML,
+			DatePublished: p.Date.Format(time.RFC3339),
+		}
+		if a := p.Info.Author; len(a.Name) > 0 {
+			dir := p.URL
+			if !strings.HasSuffix(dir, "/") {
+				dir = path.Dir(dir)
+			}
+			avatar := resolveAsset(r, dir, a.Avatar)
+			item.Authors = []jsonFeedAuthor{{Name: a.Name, URL: a.URL, Avatar: avatar}}
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Could not build feed.")
+		logRequest(r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+	fmt.Fprintf(w, "%s\n", out)
+}
+
+func writeRSS(w http.ResponseWriter, r *http.Request, fd feed) {
+	doc := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       fd.Title,
+			Link:        absURL(r, fd.URL),
+			Description: fd.Description,
+		},
+	}
+	for _, p := range fd.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       pageTitle(p),
+			Link:        absURL(r, p.URL),
+			GUID:        absURL(r, p.URL),
+			PubDate:     p.Date.Format(time.RFC1123Z),
+			Description: p.HTML,
+		})
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Could not build feed.")
+		logRequest(r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Content atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Whether a request for a directory asks for its Atom feed instead of HTML
+func wantsAtom(r *http.Request) bool {
+	return headerAccepts(r.Header.Get("Accept"), "application/atom+xml")
+}
+
+func writeAtom(w http.ResponseWriter, r *http.Request, fd feed) {
+	// Atom insists on an updated time, even for a feed with nothing in it
+	updated := time.Now()
+	if len(fd.Items) > 0 {
+		updated = fd.Items[0].Date
+	}
+	doc := atomFeed{
+		Title:   fd.Title,
+		ID:      absURL(r, fd.URL),
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: absURL(r, fd.URL)},
+			{Href: absURL(r, r.URL.Path), Rel: "self"},
+		},
+	}
+	for _, p := range fd.Items {
+		entry := atomEntry{
+			Title:   pageTitle(p),
+			ID:      absURL(r, p.URL),
+			Link:    atomLink{Href: absURL(r, p.URL)},
+			Updated: p.Date.Format(time.RFC3339),
+			Content: atomContent{Type: "html", Body: p.HTML},
+		}
+		if a := p.Info.Author; len(a.Name) > 0 {
+			entry.Author = &atomAuthor{Name: a.Name, URI: a.URL}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Could not build feed.")
+		logRequest(r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Get the titles of an RSS feed's items, in order
+func feedTitles(t *testing.T, body []byte) []string {
+	t.Helper()
+	var doc rss
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, item := range doc.Channel.Items {
+		titles = append(titles, item.Title)
+	}
+	return titles
+}
+
+func TestFeedLimit(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/blog/_index.md": "---\ntitle: Blog\nfeed:\n  limit: 2\n---\n",
+		"h/pub/blog/a.md":      "---\ntitle: A\ndate: 2020-01-01\n---\na",
+		"h/pub/blog/b.md":      "---\ntitle: B\ndate: 2022-01-01\n---\nb",
+		"h/pub/blog/c.md":      "---\ntitle: C\ndate: 2021-01-01\n---\nc",
+	})
+	w := getPage("/blog/feed.xml")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	titles := feedTitles(t, w.Body.Bytes())
+	if len(titles) != 2 || titles[0] != "B" || titles[1] != "C" {
+		t.Errorf("got items %q, want the newest two, B and C", titles)
+	}
+}
+
+func TestRecentFeed(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a/x.md": "---\ntitle: X\n---\nx",
+		"h/pub/b/y.md": "---\ntitle: Y\n---\ny",
+		"h/pub/z.md":   "---\ntitle: Z\n---\nz",
+	})
+	now := time.Now()
+	for file, age := range map[string]time.Duration{
+		"h/pub/a/x.md": time.Hour,
+		"h/pub/b/y.md": 3 * time.Hour,
+		"h/pub/z.md":   2 * time.Hour,
+	} {
+		if err := os.Chtimes(file, now, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setFlag(t, recentLimit, 2)
+	h := http.HandlerFunc(recentFeedHandler)
+	w := request(h, http.MethodGet, "/recent.xml", nil)
+	if got := strings.Join(feedTitles(t, w.Body.Bytes()), ","); w.Code != http.StatusOK || got != "X,Z" {
+		t.Errorf("got status %d with %s, want X,Z", w.Code, got)
+	}
+
+	// editing a page moves it to the top
+	if err := os.Chtimes("h/pub/b/y.md", now, now); err != nil {
+		t.Fatal(err)
+	}
+	resetCaches()
+	if got := strings.Join(feedTitles(t, request(h, http.MethodGet, "/recent.xml", nil).Body.Bytes()), ","); got != "Y,X" {
+		t.Errorf("after an edit got %s, want Y,X", got)
+	}
+}
+
+func TestRecentSitePage(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/recent.md": "own page",
+		"h/pub/a.md":      "---\ntitle: A\n---\n",
+	})
+	if w := getPage("/recent"); !strings.Contains(w.Body.String(), "own page") {
+		t.Errorf("site's recent page not served: %d %s", w.Code, w.Body.String())
+	}
+	if got := feedTitles(t, getPage("/recent.xml").Body.Bytes()); len(got) != 2 {
+		t.Errorf("recent feed got %v", got)
+	}
+	os.Remove("h/pub/recent.md")
+	resetCaches()
+	if got := strings.Join(listingTitles(getPage("/recent").Body.String()), ","); got != "A" {
+		t.Errorf("recent listing without a page got %q", got)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/b/a.md": "---\ntitle: A\nauthor: Pat\ndate: 2024-01-02\n---\nhello",
+	})
+	w := getPage("/b/feed.json")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/feed+json") {
+		t.Fatalf("got status %d with Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var feed jsonFeed
+	if err := json.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Version != "https://jsonfeed.org/version/1.1" || feed.FeedURL != "http://h/b/feed.json" {
+		t.Errorf("got version %q and feed_url %q", feed.Version, feed.FeedURL)
+	}
+	if len(feed.Items) != 1 {
+		t.Fatalf("got %d items", len(feed.Items))
+	}
+	item := feed.Items[0]
+	if item.Title != "A" || item.URL != "http://h/b/a" || !strings.Contains(item.ContentHTML, "<p>hello</p>") {
+		t.Errorf("got item %+v", item)
+	}
+	if !strings.HasPrefix(item.DatePublished, "2024-01-02T") {
+		t.Errorf("got date_published %q", item.DatePublished)
+	}
+	if len(item.Authors) != 1 || item.Authors[0].Name != "Pat" {
+		t.Errorf("got authors %+v", item.Authors)
+	}
+}
+
+func TestAtomByAccept(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/blog/a.md": "---\ndate: 2024-01-02\nauthor: Me\ntitle: A & B\n---\n*a*",
+		"h/pub/blog/b.md": "---\ndate: 2024-02-02\n---\nb",
+	})
+	h := http.HandlerFunc(pageHandler)
+	w := request(h, http.MethodGet, "/blog/", map[string]string{"Accept": "application/atom+xml"})
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/atom+xml") {
+		t.Fatalf("got status %d with Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var doc atomFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Entries) != 2 || doc.Entries[0].Title != "B" || doc.Entries[1].Title != "A & B" {
+		t.Fatalf("got entries %+v", doc.Entries)
+	}
+	a := doc.Entries[1]
+	if a.Author == nil || a.Author.Name != "Me" || a.Content.Type != "html" || !strings.Contains(a.Content.Body, "<em>a</em>") {
+		t.Errorf("got entry %+v", a)
+	}
+	if len(doc.Updated) == 0 || len(doc.ID) == 0 {
+		t.Errorf("feed without updated or id: %+v", doc)
+	}
+	w = request(h, http.MethodGet, "/blog/", map[string]string{"Accept": "text/html,application/atom+xml;q=0"})
+	if !strings.HasPrefix(w.Body.String(), "<h>Blog</h>") {
+		t.Errorf("refused Atom got %q", w.Body.String())
+	}
+}
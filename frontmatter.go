@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gernest/front"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Front matter that is never closed or won't parse
+var errFrontMatter = errors.New("broken front matter")
+
+// Split a page into its front matter and body
+// Pages without front matter are all body
+func parseFrontMatter(fileContents []byte) (map[string]interface{}, string, error) {
+	if !bytes.HasPrefix(fileContents, []byte("---")) {
+		return map[string]interface{}{}, string(fileContents), nil
+	}
+	// the parser panics on front matter without its closing ---
+	if !bytes.Contains(fileContents[3:], []byte("---")) {
+		return nil, "", fmt.Errorf("%w: no closing ---", errFrontMatter)
+	}
+	m := front.NewMatter()
+	m.Handle("---", front.YAMLHandler)
+	f, body, err := m.Parse(bytes.NewBuffer(fileContents))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errFrontMatter, err)
+	}
+	return f, body, nil
+}
+
+type parsedPage struct {
+	f    map[string]interface{}
+	body string
+}
+
+// The last page sources that parsed, by file
+var lastParsed = struct {
+	sync.Mutex
+	m map[string]parsedPage
+}{m: make(map[string]parsedPage)}
+
+// Read and parse a page source
+// A file caught halfway through being rewritten gets its last good version,
+// or errFrontMatter if it has never parsed
+func readPage(r *http.Request, filename string) (map[string]interface{}, string, error) {
+	contents, err := readFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	f, body, err := parseFrontMatter(contents)
+	lastParsed.Lock()
+	defer lastParsed.Unlock()
+	if err != nil {
+		if p, ok := lastParsed.m[filename]; ok {
+			logRequest(r, filename+":", err, "(using the last good version)")
+			return p.f, p.body, nil
+		}
+		return nil, "", err
+	}
+	lastParsed.m[filename] = parsedPage{f, body}
+	return f, body, nil
+}
+
+// Read just the front matter of the page source at an extensionless path
+func readFrontMatter(r *http.Request, base string) (map[string]interface{}, bool) {
+	for _, ext := range pageExts() {
+		f, _, err := readPage(r, base+ext)
+		if err != nil {
+			continue
+		}
+		return f, true
+	}
+	return nil, false
+}
+
+// Front matter keys NewPageInfo understands and the type each must have
+// Keys that take more than one type list them separated by |
+var frontMatterKeys = map[string]string{
+	"author":             "string|map",
+	"author_url":         "string",
+	"body_class":         "string",
+	"cache":              "int|bool|string",
+	"class":              "string",
+	"comments":           "bool",
+	"css":                "list",
+	"date":               "string",
+	"description":        "string",
+	"draft":              "bool",
+	"expires":            "string",
+	"favicon":            "string",
+	"featured":           "bool",
+	"feed":               "map",
+	"heading_shift":      "int",
+	"hidden":             "bool",
+	"image":              "string",
+	"js":                 "list",
+	"layout":             "string",
+	"order":              "string",
+	"per":                "int",
+	"permalink":          "string",
+	"pinned":             "bool",
+	"robots":             "string",
+	"series":             "string",
+	"sitemap_changefreq": "string",
+	"sitemap_priority":   "float|int",
+	"sort":               "string",
+	"status":             "int",
+	"summary_below":      "bool",
+	"tags":               "list",
+	"time":               "string",
+	"title":              "string",
+	"toc":                "bool",
+	"toc_depth":          "int",
+	"weight":             "int",
+}
+
+// Check front matter against the known keys
+// Unknown keys are only suspicious, but a mistyped known key is an error
+func validateFrontMatter(f map[string]interface{}) (warnings []string, err error) {
+	var keys []string
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		want, ok := frontMatterKeys[k]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("unknown front matter key %q", k))
+			continue
+		}
+		if got := frontMatterType(f[k]); !typeAllowed(want, got) {
+			return warnings, fmt.Errorf("front matter key %q should be %s, not %s", k, want, got)
+		}
+		switch k {
+		case "sitemap_priority":
+			if _, err := sitemapPriority(f); err != nil {
+				return warnings, err
+			}
+		case "sitemap_changefreq":
+			if _, err := sitemapChangefreq(f); err != nil {
+				return warnings, err
+			}
+		}
+		if robots, ok := f[k].(string); ok && k == "robots" {
+			for _, t := range unknownRobots(robots) {
+				warnings = append(warnings, fmt.Sprintf("unknown robots directive %q", t))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+func typeAllowed(want, got string) bool {
+	for _, t := range strings.Split(want, "|") {
+		if t == got {
+			return true
+		}
+	}
+	return false
+}
+
+func frontMatterType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case int:
+		return "int"
+	case bool:
+		return "bool"
+	case float64:
+		return "float"
+	case []interface{}:
+		return "list"
+	case map[interface{}]interface{}:
+		return "map"
+	case nil:
+		return "empty"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// In -strictFrontMatter mode, log any front matter problems for the request
+// Returns false if the page is unusable and an error has been sent
+func checkFrontMatter(w http.ResponseWriter, r *http.Request, f map[string]interface{}) bool {
+	if !*strictFrontMatter {
+		return true
+	}
+	warnings, err := validateFrontMatter(f)
+	for _, warning := range warnings {
+		logRequest(r, r.URL.Path+":", warning)
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Invalid front matter.")
+		logRequest(r, r.URL.Path+":", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStrictFrontMatter(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/typo.md":   "---\ntitel: Typo\n---\nhi",
+		"h/pub/number.md": "---\ntitle: 5\n---\nhi",
+	})
+	logged := captureLog(t)
+
+	if w := getPage("/typo"); w.Code != http.StatusOK {
+		t.Errorf("typo page got status %d without -strictFrontMatter", w.Code)
+	}
+	if logged.Len() > 0 {
+		t.Errorf("logged without -strictFrontMatter: %s", logged)
+	}
+
+	setFlag(t, strictFrontMatter, true)
+	if w := getPage("/typo"); w.Code != http.StatusOK {
+		t.Errorf("typo page got status %d", w.Code)
+	}
+	if !strings.Contains(logged.String(), `unknown front matter key "titel"`) {
+		t.Errorf("no warning for a misspelled key, logged %q", logged)
+	}
+	if w := getPage("/number"); w.Code != http.StatusInternalServerError {
+		t.Errorf("mistyped title got status %d", w.Code)
+	}
+}
+
+func TestFrontMatterTime(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	for _, c := range []struct {
+		fm         string
+		date, time string
+		raw        time.Time
+	}{
+		{"date: 2024-01-02\ntime: \"14:30\"", "2024-01-02", "14:30", time.Date(2024, 1, 2, 14, 30, 0, 0, tokyo)},
+		{"date: 2024-01-02\ntime: \"14:30+02:00\"", "2024-01-02", "21:30", time.Date(2024, 1, 2, 12, 30, 0, 0, time.UTC)},
+		{"time: 2024-03-04T05:06:07-05:00", "2024-03-04", "19:06", time.Date(2024, 3, 4, 10, 6, 7, 0, time.UTC)},
+		{"date: 2024-01-02\ntime: 2024-03-04T05:06:07-05:00", "2024-01-02", "19:06", time.Date(2024, 1, 2, 10, 6, 7, 0, time.UTC)},
+	} {
+		f, _, err := parseFrontMatter([]byte("---\n" + c.fm + "\n---\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pi := NewPageInfo(nil, f, tokyo)
+		if pi.Date != c.date || pi.Time != c.time || !pi.RawDate.Equal(c.raw) {
+			t.Errorf("%q got %s %s (%s), want %s %s (%s)", c.fm, pi.Date, pi.Time, pi.RawDate, c.date, c.time, c.raw)
+		}
+	}
+}
+
+// A page caught halfway through being saved keeps its last good version
+func TestHalfWrittenPage(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":            "---\ntitle: Good\n---\ngood body",
+		"h/pub/b.md":            "---\ntitle: [oops\n",
+		"h/templates/view.html": "{{.Title}}|{{.Page}}",
+	})
+	want := "<h>Good</h>Good|<p>good body</p>\n<f></f>"
+	if body := getPage("/a").Body.String(); body != want {
+		t.Fatalf("got %q, want %q", body, want)
+	}
+	for _, half := range []string{"---\ntitle: Go", "---\ntitle: [Go\n---\nhalf"} {
+		if err := os.WriteFile("h/pub/a.md", []byte(half), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if w := getPage("/a"); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%q got %d %q, want the last good version", half, w.Code, w.Body.String())
+		}
+	}
+	if w := getPage("/b"); w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "oops") {
+		t.Errorf("never-parsed page got %d %q", w.Code, w.Body.String())
+	}
+}
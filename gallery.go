@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strconv"
+)
+
+// An image in a gallery listing
+type GalleryImage struct {
+	Title string
+	Thumb string
+	Full  string
+}
+
+// A directory is shown as a gallery when its _index asks for one with
+// layout: gallery, or when most of what's in it is images
+func isGallery(f map[string]interface{}, dir []Link) bool {
+	if layout, ok := f["layout"].(string); ok {
+		return layout == "gallery"
+	}
+	images := 0
+	for _, l := range dir {
+		if isImage(l.Path) {
+			images++
+		}
+	}
+	return images > 0 && images*2 > len(dir)
+}
+
+// Pick the images out of a listing, with thumbnails scaled by fileHandler
+func galleryImages(dir []Link) []GalleryImage {
+	var images []GalleryImage
+	for _, l := range dir {
+		if !isImage(l.Path) {
+			continue
+		}
+		images = append(images, GalleryImage{
+			Title: l.Title,
+			Thumb: l.Path + "?w=" + strconv.Itoa(*thumbWidth),
+			Full:  l.Path,
+		})
+	}
+	return images
+}
@@ -1,10 +1,18 @@
 module github.com/chrissexton/wurk
 
-go 1.19
+go 1.22.2
 
 require (
+	github.com/HugoSmits86/nativewebp v1.1.4
+	github.com/andybalholm/brotli v1.1.0
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/gernest/front v0.0.0-20210301115436-8a0b0a782d0a
 	github.com/russross/blackfriday/v2 v2.1.0
+	golang.org/x/crypto v0.28.0
+	golang.org/x/image v0.24.0
+	golang.org/x/net v0.30.0
+	golang.org/x/sync v0.8.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
-require gopkg.in/yaml.v2 v2.4.0 // indirect
+require golang.org/x/sys v0.26.0 // indirect
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Host directory the test sites are served from
+const testHost = "h"
+
+// Templates just big enough to tell which one rendered what
+var testTemplates = map[string]string{
+	"h/pub/.keep":             "",
+	"h/templates/header.html": "<h>{{.Title}}</h>",
+	"h/templates/view.html":   "<v>{{.Page}}</v>",
+	"h/templates/dir.html":    "<d>{{range .Dir}}[{{.Title}}|{{.Path}}]{{end}}</d>",
+	"h/templates/footer.html": "<f></f>",
+}
+
+// Write files, by path relative to the working directory, into a fresh
+// directory and work from there for the rest of the test
+// Files named in files replace the test templates of the same name
+func newSite(t testing.TB, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	all := make(map[string]string)
+	for name, contents := range testTemplates {
+		all[name] = contents
+	}
+	for name, contents := range files {
+		all[name] = contents
+	}
+	for name, contents := range all {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resetCaches()
+	old, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(old)
+		resetCaches()
+	})
+	return dir
+}
+
+// Forget everything cached from another test's site
+func resetCaches() {
+	templates.Lock()
+	templates.m = make(map[string]templateCache)
+	templates.Unlock()
+	sites.Lock()
+	sites.m = make(map[string]siteCache)
+	sites.Unlock()
+	hostConfigs.Lock()
+	hostConfigs.m = make(map[string]hostConfigCache)
+	hostConfigs.Unlock()
+	childCounts.Lock()
+	childCounts.m = make(map[string]childCountCache)
+	childCounts.Unlock()
+	lastParsed.Lock()
+	lastParsed.m = make(map[string]parsedPage)
+	lastParsed.Unlock()
+	injects.Lock()
+	injects.m = make(map[string]injectCache)
+	injects.Unlock()
+	webps.Lock()
+	webps.m = make(map[string]webpCache)
+	webps.Unlock()
+	trees.Lock()
+	trees.m = make(map[string]treeCache)
+	trees.Unlock()
+	accessLogs.Lock()
+	for _, f := range accessLogs.m {
+		f.Close()
+	}
+	accessLogs.m = make(map[string]*os.File)
+	accessLogs.Unlock()
+}
+
+// Set a flag for the rest of the test
+func setFlag[T any](t testing.TB, flag *T, value T) {
+	t.Helper()
+	old := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = old })
+}
+
+// Make a GET request for target on the test host
+func hostRequest(target string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Host = testHost
+	return r
+}
+
+// Make a request of the test host and record the response
+func request(h http.Handler, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	r := hostRequest(target)
+	r.Method = method
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// GET a page of the test host through pageHandler
+func getPage(target string) *httptest.ResponseRecorder {
+	return request(http.HandlerFunc(pageHandler), http.MethodGet, target, nil)
+}
+
+// Collect what's logged for the rest of the test
+func captureLog(t testing.TB) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"gopkg.in/yaml.v2"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Settings a host can give itself in a wurk.yaml beside its pub directory
+type hostConfig struct {
+	// File this host's requests are logged to, inside the host directory
+	AccessLog string `yaml:"access_log"`
+	// Time zone for dates without an offset, in place of -timezone
+	Timezone string `yaml:"timezone"`
+	// Users who can sign in with basic auth, mapped to a bcrypt hash of
+	// their password, so templates can show them more
+	Users map[string]string `yaml:"users"`
+}
+
+type hostConfigCache struct {
+	config hostConfig
+	ts     time.Time
+}
+
+var hostConfigs = struct {
+	sync.Mutex
+	m map[string]hostConfigCache
+}{m: make(map[string]hostConfigCache)}
+
+// Get a host directory's wurk.yaml, rereading it after cacheTimeout
+// Hosts without one, or with a broken one, get the defaults, and so do hosts
+// that aren't served, without being cached, so made up Host headers can't
+// fill the cache
+func loadHostConfig(host string) hostConfig {
+	hostConfigs.Lock()
+	defer hostConfigs.Unlock()
+	hc, ok := hostConfigs.m[host]
+	if !*noCache && ok && hc.ts.After(time.Now().Add(-*cacheTimeout)) {
+		return hc.config
+	}
+	if !hostExists(host) {
+		return hostConfig{}
+	}
+	hc = hostConfigCache{ts: time.Now()}
+	if contents, err := readFile(filepath.Join(host, "wurk.yaml")); err == nil {
+		if err := yaml.UnmarshalStrict(contents, &hc.config); err != nil {
+			log.Println(filepath.Join(host, "wurk.yaml")+":", err)
+			hc.config = hostConfig{}
+		}
+	}
+	hostConfigs.m[host] = hc
+	return hc.config
+}
+
+// Check whether host is a directory being served
+func hostExists(host string) bool {
+	_, st, err := resolvePath(filepath.Join(host, "pub"))
+	return err == nil && st.IsDir()
+}
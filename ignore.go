@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Get the glob patterns of files to hide below the public directory root,
+// from -ignore and the host's .wurkignore file
+// A pattern ending in / only matches directories
+func ignorePatterns(root string) []string {
+	list := *ignore
+	if contents, err := readFile(filepath.Join(filepath.Dir(root), ".wurkignore")); err == nil {
+		list += "\n" + string(contents)
+	}
+	var patterns []string
+	for _, p := range strings.FieldsFunc(list, func(c rune) bool { return c == ',' || c == '\n' }) {
+		p = strings.TrimSpace(p)
+		if len(p) == 0 || p[0] == '#' {
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// Check whether a file p below the public directory root matches a pattern
+// Patterns without a slash match any name along the way, like tmp/ or *.draft.md,
+// and ones with a slash match from root, like notes/*.md
+func ignored(patterns []string, root, p string, isDir bool) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for _, pattern := range patterns {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.Trim(pattern, "/")
+		for i := range parts {
+			if dirOnly && i == len(parts)-1 && !isDir {
+				continue
+			}
+			name := parts[i]
+			if strings.Contains(pattern, "/") {
+				name = strings.Join(parts[:i+1], "/")
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
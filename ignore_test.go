@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWurkIgnore(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/.wurkignore":     "# not for readers\n*.draft.md\ntmp/\n",
+		"h/pub/a.md":        "a",
+		"h/pub/b.draft.md":  "b",
+		"h/pub/tmp/c.md":    "c",
+		"h/pub/tmp.txt":     "t",
+		"h/pub/d/tmp/e.png": "e",
+		"h/pub/d/f.md":      "f",
+	})
+	captureLog(t)
+	if got := strings.Join(listingTitles(getPage("/").Body.String()), ","); got != "A,D,Tmp.txt" {
+		t.Errorf("listing has %s", got)
+	}
+	if got := strings.Join(listingTitles(getPage("/d/").Body.String()), ","); got != "F" {
+		t.Errorf("/d/ listing has %s", got)
+	}
+	for _, target := range []string{"/b.draft", "/b.draft.md", "/tmp/c", "/tmp/", "/d/tmp/e.png"} {
+		if w := getPage(target); w.Code != http.StatusNotFound {
+			t.Errorf("%s got status %d", target, w.Code)
+		}
+	}
+	for _, target := range []string{"/a", "/tmp.txt"} {
+		if w := getPage(target); w.Code != http.StatusOK {
+			t.Errorf("%s got status %d", target, w.Code)
+		}
+	}
+	if n := len(sitePages(hostRequest("/"))); n != 2 {
+		t.Errorf("site has %d pages, want 2", n)
+	}
+}
+
+func TestIgnoreFlag(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":         "a",
+		"h/pub/notes/b.md":   "b",
+		"h/pub/c/notes/d.md": "d",
+	})
+	setFlag(t, ignore, "notes/*.md")
+	captureLog(t)
+	if w := getPage("/notes/b"); w.Code != http.StatusNotFound {
+		t.Errorf("/notes/b got status %d", w.Code)
+	}
+	// patterns with a slash match from the root only
+	if w := getPage("/c/notes/d"); w.Code != http.StatusOK {
+		t.Errorf("/c/notes/d got status %d", w.Code)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/image/draw"
+	"html"
+	"html/template"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Largest image, in pixels, that will be decoded to be resized or converted
+// A small file can claim huge dimensions, and decoding allocates for all of them
+const maxImagePixels = 50 << 20
+
+var imgTag = regexp.MustCompile(`<img[^>]*>`)
+var srcAttr = regexp.MustCompile(`src="([^"]*)"`)
+
+var loadingAttr = regexp.MustCompile(`\sloading=`)
+var decodingAttr = regexp.MustCompile(`\sdecoding=`)
+
+// Mark images to load lazily and decode off the main thread
+// Images that already say how to load or decode are left alone
+func lazyImages(html []byte) []byte {
+	return imgTag.ReplaceAllFunc(html, func(tag []byte) []byte {
+		var attrs string
+		if !loadingAttr.Match(tag) {
+			attrs += ` loading="lazy"`
+		}
+		if !decodingAttr.Match(tag) {
+			attrs += ` decoding="async"`
+		}
+		return append([]byte("<img"+attrs), tag[len("<img"):]...)
+	})
+}
+
+// Swap local <img> sources for data URIs when the image is small enough
+// root is the public directory, dir is the directory of the page being rendered
+func inlineImages(root, dir string, html []byte, limit int64) []byte {
+	return imgTag.ReplaceAllFunc(html, func(tag []byte) []byte {
+		m := srcAttr.FindSubmatch(tag)
+		if m == nil {
+			return tag
+		}
+		filename, ok := localFile(root, dir, string(m[1]))
+		if !ok {
+			return tag
+		}
+		typ := mime.TypeByExtension(filepath.Ext(filename))
+		if !strings.HasPrefix(typ, "image/") {
+			return tag
+		}
+		filename, st, err := resolvePath(filename)
+		if err != nil || st.IsDir() || st.Size() > limit {
+			return tag
+		}
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			return tag
+		}
+		uri := "data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(contents)
+		return srcAttr.ReplaceAll(tag, []byte(`src="`+uri+`"`))
+	})
+}
+
+// Resolve a link from a page to a file under root
+// Absolute links start at root, relative ones at dir
+// Anything remote or escaping root is refused
+func localFile(root, dir, src string) (string, bool) {
+	if len(src) == 0 || strings.Contains(src, ":") || strings.HasPrefix(src, "//") {
+		return "", false
+	}
+	if i := strings.IndexAny(src, "?#"); i >= 0 {
+		src = src[:i]
+	}
+	var filename string
+	if src[0] == '/' {
+		filename = filepath.Join(root, filepath.FromSlash(src))
+	} else {
+		filename = filepath.Join(dir, filepath.FromSlash(src))
+	}
+	root = filepath.Clean(root)
+	if !strings.HasPrefix(filename, root+string(filepath.Separator)) {
+		return "", false
+	}
+	return filename, true
+}
+
+// Get the source of the first linked image in a page, for a thumbnail
+// Images inlined as data URIs are passed over
+func firstImage(page template.HTML) string {
+	for _, tag := range imgTag.FindAllString(string(page), -1) {
+		if m := srcAttr.FindStringSubmatch(tag); m != nil && !strings.HasPrefix(m[1], "data:") {
+			return html.UnescapeString(m[1])
+		}
+	}
+	return ""
+}
+
+// Whether a file name looks like an image we can show
+func isImage(name string) bool {
+	return strings.HasPrefix(mime.TypeByExtension(filepath.Ext(name)), "image/")
+}
+
+// Serve the -missingImage placeholder for an image that isn't there,
+// so pages show it rather than a broken image
+func serveMissingImage(w http.ResponseWriter, r *http.Request) {
+	contents, err := os.ReadFile(*missingImage)
+	if err != nil {
+		renderError(w, r, http.StatusNotFound, "Could not load "+r.URL.Path)
+		logRequest(r, "Couldn't read missing image placeholder:", err)
+		return
+	}
+	typ := mime.TypeByExtension(filepath.Ext(*missingImage))
+	if len(typ) == 0 {
+		typ = http.DetectContentType(contents)
+	}
+	w.Header().Set("Content-Type", typ)
+	w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(*missingImageStatus)
+	if r.Method != http.MethodHead {
+		w.Write(contents)
+	}
+}
+
+// Serve an image scaled down to the width in ?w=
+// Only -thumbWidth and the -resizeWidths are offered, so a client can't make
+// the server scale every image to every width
+// Returns false if the request isn't for a resizable image
+func serveResized(w http.ResponseWriter, r *http.Request, filename string) bool {
+	width, err := strconv.Atoi(r.URL.Query().Get("w"))
+	if err != nil || !resizeAllowed(width) {
+		return false
+	}
+	st, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+	// resizes are kept in the -cacheDir, if there is one
+	key := cacheKey("resize", filename, st.ModTime().String(), strconv.Itoa(width))
+	out, ok := cacheGet(key)
+	if !ok {
+		out, _, err = resizeImage(filename, width)
+		if err != nil {
+			logRequest(r, "Couldn't resize", filename, err)
+			return false
+		}
+		cachePut(r, key, out)
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(out))
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	if r.Method != http.MethodHead {
+		w.Write(out)
+	}
+	return true
+}
+
+// Check whether ?w= may scale images to width
+func resizeAllowed(width int) bool {
+	if width <= 0 {
+		return false
+	}
+	if width == *thumbWidth {
+		return true
+	}
+	for _, s := range strings.Split(*resizeWidths, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil && n == width {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode an image file, refusing any bigger than maxImagePixels
+func decodeImage(filename string) (image.Image, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	c, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, "", err
+	}
+	if c.Width <= 0 || c.Height <= 0 || int64(c.Width)*int64(c.Height) > maxImagePixels {
+		return nil, "", fmt.Errorf("image is %dx%d, too big to decode", c.Width, c.Height)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+	return image.Decode(f)
+}
+
+// Scale an image file to width, keeping its aspect ratio and format
+// Images are never scaled up
+func resizeImage(filename string, width int) ([]byte, string, error) {
+	src, format, err := decodeImage(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	b := src.Bounds()
+	if width > b.Dx() {
+		width = b.Dx()
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	case "gif":
+		err = gif.Encode(&buf, dst, nil)
+	default:
+		format = "png"
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/" + format, nil
+}
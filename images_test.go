@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInlineImages(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/post/p.md":      "![small](small.png) ![big](/big.png) ![escape](../../../secret.png)",
+		"h/pub/post/small.png": "tiny",
+		"h/pub/big.png":        strings.Repeat("x", 5000),
+		"secret.png":           "secret",
+	})
+	setFlag(t, inlineLimit, 100)
+	body := getPage("/post/p").Body.String()
+	if !strings.Contains(body, `src="data:image/png;base64,dGlueQ=="`) {
+		t.Errorf("small image not inlined: %s", body)
+	}
+	if !strings.Contains(body, `src="/big.png"`) {
+		t.Errorf("big image inlined: %s", body)
+	}
+	if !strings.Contains(body, `src="../../../secret.png"`) {
+		t.Errorf("image outside pub inlined: %s", body)
+	}
+}
+
+func TestLazyImages(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md": "![x](a.png)\n\n<img src=\"b.png\" loading=\"eager\">\n\n<img decoding=\"sync\" src=c.png>",
+	})
+	body := getPage("/a").Body.String()
+	for _, want := range []string{
+		`<img loading="lazy" decoding="async" src="a.png" alt="x" />`,
+		`<img decoding="async" src="b.png" loading="eager">`,
+		`<img loading="lazy" decoding="sync" src=c.png>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in %s", want, body)
+		}
+	}
+	setFlag(t, lazyLoad, false)
+	resetCaches()
+	if body := getPage("/a").Body.String(); strings.Contains(body, `loading="lazy"`) {
+		t.Errorf("-lazyImages=false still added attributes: %s", body)
+	}
+}
+
+// Encode a blank image in format
+func testImage(t *testing.T, format string, width, height int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var buf bytes.Buffer
+	var err error
+	if format == "gif" {
+		err = gif.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestGallery(t *testing.T) {
+	pic := testImage(t, "png", 800, 400)
+	newSite(t, map[string]string{
+		"h/templates/gallery.html": "{{range .Gallery}}[{{.Title}}|{{.Thumb}}|{{.Full}}]{{end}}",
+		"h/pub/g/a.png":            pic,
+		"h/pub/g/b.png":            pic,
+		"h/pub/g/c.md":             "c",
+	})
+	setFlag(t, thumbWidth, 100)
+	body := getPage("/g/").Body.String()
+	if want := "[A.png|/g/a.png?w=100|/g/a.png][B.png|/g/b.png?w=100|/g/b.png]"; !strings.Contains(body, want) {
+		t.Errorf("got %q, want it to contain %q", body, want)
+	}
+	w := getPage("/g/a.png?w=100")
+	c, err := png.DecodeConfig(w.Body)
+	if err != nil || c.Width != 100 || c.Height != 50 {
+		t.Errorf("thumbnail is %dx%d: %v", c.Width, c.Height, err)
+	}
+}
+
+func TestResizeTooBig(t *testing.T) {
+	// a tiny GIF claiming to be 65535 pixels square
+	pic := []byte(testImage(t, "gif", 1, 1))
+	copy(pic[6:10], []byte{0xff, 0xff, 0xff, 0xff})
+	newSite(t, map[string]string{"h/pub/big.gif": string(pic)})
+	if _, _, err := resizeImage(filepath.Join(testHost, "pub", "big.gif"), 10); err == nil {
+		t.Error("resized an image over the pixel limit")
+	}
+	if _, err := convertWebP(filepath.Join(testHost, "pub", "big.gif")); err == nil {
+		t.Error("converted an image over the pixel limit")
+	}
+	setFlag(t, resizeWidths, "10")
+	captureLog(t)
+	if w := getPage("/big.gif?w=10"); w.Body.String() != string(pic) {
+		t.Errorf("got %d bytes, want the original", w.Body.Len())
+	}
+}
+
+func TestResizeWidths(t *testing.T) {
+	pic := testImage(t, "png", 40, 40)
+	newSite(t, map[string]string{"h/pub/a.png": pic})
+	setFlag(t, thumbWidth, 30)
+	setFlag(t, resizeWidths, "10, 20")
+	for target, want := range map[string]int{
+		"/a.png?w=10": 10,
+		"/a.png?w=20": 20,
+		"/a.png?w=30": 30,
+		"/a.png?w=15": 40,
+		"/a.png?w=0":  40,
+	} {
+		c, err := png.DecodeConfig(getPage(target).Body)
+		if err != nil || c.Width != want {
+			t.Errorf("%s is %d wide, want %d: %v", target, c.Width, want, err)
+		}
+	}
+}
+
+func TestMissingImage(t *testing.T) {
+	newSite(t, map[string]string{"placeholder.png": "\x89PNG\r\n\x1a\nplaceholder"})
+	setFlag(t, missingImage, "placeholder.png")
+	w := getPage("/nope.png")
+	if w.Code != http.StatusNotFound || w.Body.String() != "\x89PNG\r\n\x1a\nplaceholder" {
+		t.Errorf("got status %d: %q", w.Code, w.Body.String())
+	}
+	if typ := w.Header().Get("Content-Type"); typ != "image/png" {
+		t.Errorf("got Content-Type %q", typ)
+	}
+	setFlag(t, missingImageStatus, http.StatusOK)
+	if w := getPage("/x/nope.JPG"); w.Code != http.StatusOK || !strings.HasSuffix(w.Body.String(), "placeholder") {
+		t.Errorf("-missingImageStatus 200 got status %d", w.Code)
+	}
+	if w := getPage("/nope.txt"); w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "placeholder") {
+		t.Errorf("missing text file got status %d: %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type injectCache struct {
+	snippet []byte
+	mod     time.Time
+}
+
+// The -headInject and -bodyInject files, reread whenever they change
+var injects = struct {
+	sync.Mutex
+	m map[string]injectCache
+}{m: make(map[string]injectCache)}
+
+// Get the contents of an operator's snippet file, or nothing if it's unset
+// or can't be read
+func injectSnippet(r *http.Request, filename string) []byte {
+	if len(filename) == 0 {
+		return nil
+	}
+	st, err := os.Stat(filename)
+	if err != nil {
+		logRequest(r, "Couldn't read snippet:", err)
+		return nil
+	}
+	injects.Lock()
+	defer injects.Unlock()
+	ic, ok := injects.m[filename]
+	if !*noCache && ok && ic.mod.Equal(st.ModTime()) {
+		return ic.snippet
+	}
+	snippet, err := os.ReadFile(filename)
+	if err != nil {
+		logRequest(r, "Couldn't read snippet:", err)
+		return nil
+	}
+	injects.m[filename] = injectCache{snippet: snippet, mod: st.ModTime()}
+	return snippet
+}
+
+// Put a snippet just after the <head> tag, or at the start without one
+func injectAfterHeadStart(page, snippet []byte) []byte {
+	at := 0
+	for i := 0; ; {
+		j := bytes.Index(page[i:], []byte("<head"))
+		if j < 0 {
+			break
+		}
+		i += j + len("<head")
+		// not <header>
+		if i < len(page) && (page[i] == '>' || page[i] == ' ' || page[i] == '\t' || page[i] == '\n') {
+			if end := bytes.IndexByte(page[i:], '>'); end >= 0 {
+				at = i + end + 1
+			}
+			break
+		}
+	}
+	out := make([]byte, 0, len(page)+len(snippet))
+	out = append(out, page[:at]...)
+	out = append(out, snippet...)
+	return append(out, page[at:]...)
+}
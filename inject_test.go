@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInject(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/header.html": "<html><head><title>x</title></head><body>",
+		"h/templates/footer.html": "</body></html>",
+		"h/pub/a.md":              "a",
+		"head.html":               "<script>analytics</script>",
+		"body.html":               "<div>banner</div>",
+	})
+	setFlag(t, headInject, "head.html")
+	setFlag(t, bodyInject, "body.html")
+	body := getPage("/a").Body.String()
+	if !strings.HasPrefix(body, "<html><head><script>analytics</script><title>") || !strings.HasSuffix(body, "<div>banner</div></body></html>") {
+		t.Errorf("got %q", body)
+	}
+	if err := os.WriteFile("body.html", []byte("<div>new</div>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes("body.html", later, later)
+	if body := getPage("/a").Body.String(); !strings.HasSuffix(body, "<div>new</div></body></html>") {
+		t.Errorf("changed snippet not used: %q", body)
+	}
+	for _, c := range []struct{ page, want string }{
+		{"<head lang=x>t", "<head lang=x>St"},
+		{"<header>x", "S<header>x"},
+	} {
+		if got := string(injectAfterHeadStart([]byte(c.page), []byte("S"))); got != c.want {
+			t.Errorf("%q got %q, want %q", c.page, got, c.want)
+		}
+	}
+}
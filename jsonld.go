@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// Build schema.org Article JSON-LD for a page
+// It's template.JS rather than template.HTML so it can go straight into a
+// <script type="application/ld+json"> without being quoted as a string
+// Only pages with a date in their front matter say when they were published
+func articleJSONLD(r *http.Request, info PageInfo, f map[string]interface{}) template.JS {
+	article := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    "Article",
+		"headline": info.Title,
+	}
+	if hasDate(f) {
+		article["datePublished"] = info.RawDate.Format(time.RFC3339)
+	}
+	if a := info.Author; len(a.Name) > 0 {
+		author := map[string]string{
+			"@type": "Person",
+			"name":  a.Name,
+		}
+		if len(a.URL) > 0 {
+			author["url"] = a.URL
+		}
+		if len(a.Avatar) > 0 {
+			author["image"] = a.Avatar
+		}
+		article["author"] = author
+	}
+	if len(info.Thumbnail) > 0 {
+		article["image"] = info.Thumbnail
+	}
+	out, err := json.Marshal(article)
+	if err != nil {
+		logRequest(r, err)
+		return ""
+	}
+	return template.JS(out)
+}
+
+// Build a schema.org BreadcrumbList from a page's breadcrumbs
+func breadcrumbJSONLD(r *http.Request, crumbs []Link) template.JS {
+	if len(crumbs) == 0 {
+		return ""
+	}
+	var items []map[string]interface{}
+	for i, c := range crumbs {
+		items = append(items, map[string]interface{}{
+			"@type":    "ListItem",
+			"position": i + 1,
+			"name":     c.Title,
+			"item":     absURL(r, c.Path),
+		})
+	}
+	out, err := json.Marshal(map[string]interface{}{
+		"@context":        "https://schema.org",
+		"@type":           "BreadcrumbList",
+		"itemListElement": items,
+	})
+	if err != nil {
+		logRequest(r, err)
+		return ""
+	}
+	return template.JS(out)
+}
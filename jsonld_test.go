@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Pull the JSON out of the first script in a page
+func scriptJSON(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	_, rest, _ := strings.Cut(body, "<script type=\"application/ld+json\">")
+	js, _, _ := strings.Cut(rest, "</script>")
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(js), &v); err != nil {
+		t.Fatalf("%v in %q", err, body)
+	}
+	return v
+}
+
+func TestArticleJSONLD(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/header.html": `<script type="application/ld+json">{{.JSONLD}}</script>`,
+		"h/pub/blog/post.md":      "---\ntitle: Hello </script>\nauthor: Chris\ndate: 2024-01-02\nimage: cover.png\n---\nx",
+		"h/pub/blog/undated.md":   "---\ntitle: Undated\n---\nx",
+		"h/pub/blog/timed.md":     "---\ntime: 2024-01-02T15:04:05+09:00\n---\nx",
+	})
+	v := scriptJSON(t, getPage("/blog/post").Body.String())
+	author, _ := v["author"].(map[string]interface{})
+	if v["@type"] != "Article" || v["headline"] != "Hello </script>" || v["datePublished"] != "2024-01-02T00:00:00Z" ||
+		v["image"] != "http://h/blog/cover.png" || author["name"] != "Chris" {
+		t.Errorf("got %v", v)
+	}
+	if v := scriptJSON(t, getPage("/blog/undated").Body.String()); v["datePublished"] != nil {
+		t.Errorf("undated page published %v", v["datePublished"])
+	}
+	if v := scriptJSON(t, getPage("/blog/timed").Body.String()); v["datePublished"] != "2024-01-02T15:04:05+09:00" {
+		t.Errorf("timed page published %v", v["datePublished"])
+	}
+}
+
+func TestBreadcrumbJSONLD(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/header.html":   `<script type="application/ld+json">{{.CrumbJSONLD}}</script>`,
+		"h/pub/docs/guide/intro.md": "x",
+	})
+	v := scriptJSON(t, getPage("/docs/guide/intro").Body.String())
+	items, _ := v["itemListElement"].([]interface{})
+	if v["@type"] != "BreadcrumbList" || len(items) != 4 {
+		t.Fatalf("got %v", v)
+	}
+	for i, want := range []string{"http://h/", "http://h/docs", "http://h/docs/guide", "http://h/docs/guide/intro"} {
+		item, _ := items[i].(map[string]interface{})
+		if item["position"] != float64(i+1) || item["item"] != want {
+			t.Errorf("item %d got %v, want position %d at %s", i, item, i+1, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Check whether lang is one of -languages
+func knownLanguage(lang string) bool {
+	for _, l := range strings.Split(*languages, ",") {
+		if l = strings.TrimSpace(l); len(l) > 0 && l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Take a language prefix like /fr/ off the request, remembering the language
+// Paths starting with anything but one of -languages are left alone
+func withLanguages(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if len(*languages) == 0 || !knownLanguage(first) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/"+first+"/") {
+			http.Redirect(w, r, prefixURL(mountPrefix(r), "/"+first+"/"), http.StatusMovedPermanently)
+			return
+		}
+		r2 := r.Clone(context.WithValue(r.Context(), langKey, first))
+		r2.URL.Path = "/" + rest
+		r2.URL.RawPath = ""
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// Get the language a request's path asked for, if any
+func requestLanguage(r *http.Request) string {
+	lang, _ := r.Context().Value(langKey).(string)
+	return lang
+}
+
+// Get the file for a request in its language's directory of pub, if the
+// language has its own version, so /fr/about can be pub/fr/about.md
+func languagePath(r *http.Request) (string, bool) {
+	lang := requestLanguage(r)
+	if len(lang) == 0 {
+		return "", false
+	}
+	p := filepath.Join(getPubRoot(r), lang, r.URL.Path)
+	if _, _, err := resolvePath(p); err == nil {
+		return p, true
+	}
+	for _, ext := range pageExts() {
+		if _, _, err := resolvePath(trimPageExt(p) + ext); err == nil {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// Put the request's language prefix on a URL of its site
+// URLs already in the language's directory have it
+func languageURL(r *http.Request, u string) string {
+	lang := requestLanguage(r)
+	if len(lang) == 0 || len(u) == 0 || u[0] != '/' || strings.HasPrefix(u+"/", "/"+lang+"/") {
+		return u
+	}
+	return "/" + lang + u
+}
+
+// Turn a URL of the request's site into one the client can follow,
+// with the site's mount and language prefixes
+func siteURL(r *http.Request, u string) string {
+	return prefixURL(mountPrefix(r), languageURL(r, u))
+}
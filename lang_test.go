@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLanguagePrefix(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/about.md":          "english",
+		"h/pub/fr/about.md":       "français",
+		"h/pub/only.md":           "shared",
+		"h/templates/header.html": "[{{.Lang}}]{{range .BreadCrumb}}[{{.Path}}]{{end}}",
+	})
+	setFlag(t, languages, "en, fr")
+	h := withLanguages(readOnly(pageHandler))
+	for target, want := range map[string]string{
+		"/fr/about": "[fr][/fr/][/fr/about]<v><p>français</p>\n</v><f></f>",
+		"/fr/only":  "[fr][/fr/][/fr/only]<v><p>shared</p>\n</v><f></f>",
+		"/en/about": "[en][/en/][/en/about]<v><p>english</p>\n</v><f></f>",
+		"/about":    "[][/][/about]<v><p>english</p>\n</v><f></f>",
+	} {
+		if w := request(h, "GET", target, nil); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s got %d %q, want %q", target, w.Code, w.Body.String(), want)
+		}
+	}
+	captureLog(t)
+	if w := request(h, "GET", "/de/about", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown language got %d", w.Code)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var hrefAttr = regexp.MustCompile(`href="([^"]*)"`)
+
+// Check the internal links of every page of every host
+// Returns a description of each link that goes nowhere
+func checkAllLinks() []string {
+	var broken []string
+	for _, host := range listHosts() {
+		broken = append(broken, checkLinks(filepath.Join(host, "pub"))...)
+	}
+	return broken
+}
+
+// Walk the pages under root and report internal links that don't resolve
+func checkLinks(root string) []string {
+	var broken []string
+	walkRoots(root, func(path string, d fs.DirEntry) error {
+		if d.IsDir() || trimPageExt(path) == path {
+			return nil
+		}
+		f, body, err := readPage(nil, path)
+		if err != nil {
+			return nil
+		}
+		html := renderBody(nil, filepath.Ext(path), f, body)
+		for _, m := range hrefAttr.FindAllStringSubmatch(string(html), -1) {
+			href := m[1]
+			if isExternal(href) {
+				continue
+			}
+			if !linkResolves(root, filepath.Dir(path), href) {
+				broken = append(broken, fmt.Sprintf("%s: broken link to %s", path, href))
+			}
+		}
+		return nil
+	})
+	return broken
+}
+
+// Links with a scheme, protocol-relative links and bare fragments aren't ours to check
+func isExternal(href string) bool {
+	return len(href) == 0 || href[0] == '#' || strings.Contains(href, ":") || strings.HasPrefix(href, "//")
+}
+
+// Decide whether pageHandler would find something for a link
+// This mirrors the lookup order: permalink, built-in route, page source,
+// directory index page, then raw file or directory
+func linkResolves(root, dir, href string) bool {
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+	if href == "/" || len(href) == 0 {
+		return true
+	}
+	filename, ok := localFile(root, dir, href)
+	if !ok {
+		return filepath.Clean(filepath.Join(dir, href)) == filepath.Clean(root)
+	}
+	u := "/" + filepath.ToSlash(strings.TrimPrefix(filename, filepath.Clean(root)+string(filepath.Separator)))
+	if _, ok := permalinkFile(root, u); ok {
+		return true
+	}
+	if builtinRoute(root, u) {
+		return true
+	}
+	filename = trimPageExt(filename)
+	for _, ext := range pageExts() {
+		if _, _, err := resolvePath(filename + ext); err == nil {
+			return true
+		}
+		if _, _, err := resolvePath(filepath.Join(filename, "index") + ext); err == nil {
+			return true
+		}
+	}
+	_, _, err := resolvePath(filename)
+	return err == nil
+}
+
+// Decide whether wurk serves a URL itself rather than from the pub directory
+// Assets only count when the file is in the host's assets directory
+func builtinRoute(root, u string) bool {
+	if strings.HasPrefix(u+"/", assetsURL()) {
+		rel := path.Clean("/" + strings.TrimPrefix(u, assetsURL()))
+		_, st, err := resolvePath(filepath.Join(filepath.Dir(root), "assets", filepath.FromSlash(rel)))
+		return err == nil && !st.IsDir()
+	}
+	switch u {
+	case "/search-index.json", "/manifest.json", "/recent", "/recent.xml", "/bundle.css", "/bundle.js":
+		return true
+	}
+	base := path.Base(u)
+	return base == "feed.xml" || base == "feed.json" || isSitemap(u) || strings.HasPrefix(u, "/series/")
+}
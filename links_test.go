@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md": "[good](/b) [dangling](/nowhere) [external](https://example.com/)",
+		"h/pub/b.md": "b",
+	})
+	broken := checkAllLinks()
+	if len(broken) != 1 || !strings.Contains(broken[0], "broken link to /nowhere") {
+		t.Errorf("got broken links %q, want just /nowhere", broken)
+	}
+}
+
+func TestCheckLinksRoutes(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":        "[p](/short) [css](/assets/site.css) [feed](/feed.xml) [recent](/recent) [gone](/assets/gone.css)",
+		"h/pub/d/b.md":      "---\npermalink: /short\n---\n[rel](feed.xml)",
+		"h/assets/site.css": "body{}",
+	})
+	broken := checkAllLinks()
+	if len(broken) != 1 || !strings.Contains(broken[0], "broken link to /assets/gone.css") {
+		t.Errorf("got broken links %q, want just /assets/gone.css", broken)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How a directory listing is sorted and split into pages
+// Most entries a page of a listing may ask for
+const maxPer = 1000
+
+type listing struct {
+	Sort  string
+	Order string
+	Per   int
+	Page  int
+}
+
+// Work out the listing options for a directory
+// Query params win over the defaults in the directory's _index front matter
+func listingOptions(r *http.Request, f map[string]interface{}) listing {
+	q := r.URL.Query()
+	opts := listing{Sort: "name", Order: "asc", Page: 1}
+	if s, ok := f["sort"].(string); ok {
+		opts.Sort = s
+	}
+	if o, ok := f["order"].(string); ok {
+		opts.Order = o
+	}
+	if p, ok := f["per"].(int); ok {
+		opts.Per = p
+	}
+	if s := q.Get("sort"); len(s) > 0 {
+		opts.Sort = s
+	}
+	if o := q.Get("order"); len(o) > 0 {
+		opts.Order = o
+	}
+	if p, err := strconv.Atoi(q.Get("per")); err == nil {
+		opts.Per = p
+	}
+	if p, err := strconv.Atoi(q.Get("page")); err == nil && p > 0 {
+		opts.Page = p
+	}
+	if opts.Per > maxPer {
+		opts.Per = maxPer
+	}
+	return opts
+}
+
+// Sort links and cut out the requested page of them
+// Pinned links come first, newest first, whatever the sort
+// Also reports whether there are more pages after this one
+func (l listing) arrange(links []Link) ([]Link, bool) {
+	var less func(i, j int) bool
+	switch l.Sort {
+	case "date":
+		less = func(i, j int) bool { return links[i].Date.Before(links[j].Date) }
+	case "title":
+		less = func(i, j int) bool { return strings.ToLower(links[i].Title) < strings.ToLower(links[j].Title) }
+	default:
+		less = func(i, j int) bool { return links[i].Path < links[j].Path }
+	}
+	if l.Order == "desc" {
+		asc := less
+		less = func(i, j int) bool { return asc(j, i) }
+	}
+	sort.SliceStable(links, less)
+	sort.SliceStable(links, func(i, j int) bool {
+		if links[i].Pinned != links[j].Pinned {
+			return links[i].Pinned
+		}
+		return links[i].Pinned && links[i].Date.After(links[j].Date)
+	})
+	if l.Per <= 0 {
+		return links, false
+	}
+	// check the page exists before multiplying, so a huge one can't overflow
+	if l.Page-1 > len(links)/l.Per {
+		return nil, false
+	}
+	start := (l.Page - 1) * l.Per
+	if start >= len(links) {
+		return nil, false
+	}
+	end := start + l.Per
+	if end >= len(links) {
+		return links[start:], false
+	}
+	return links[start:end], true
+}
+
+// Link to another page of the listing, keeping the rest of the query
+func (l listing) pageURL(r *http.Request, page int) string {
+	q := r.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+// List the directory at path and the directories below it, depth levels deep
+// Each directory's Link holds its own listing as Children
+func dirTree(r *http.Request, path string, depth int) []Link {
+	if depth <= 0 {
+		return nil
+	}
+	links, err := loadDir(r, path)
+	if err != nil {
+		return nil
+	}
+	for i, l := range links {
+		if strings.HasSuffix(l.Path, "/") {
+			sub := filepath.Join(getPubRoot(r), filepath.FromSlash(l.Path))
+			links[i].Children = dirTree(r, sub, depth-1)
+		}
+	}
+	return links
+}
+
+type treeCache struct {
+	links []Link
+	ts    time.Time
+}
+
+// Directory trees by root, depth, the site URL they link into and any
+// country blocked.txt has rules for, so -treeDepth doesn't walk the site for
+// every page and no tree shows a page blocked.txt keeps from its reader
+var trees = struct {
+	sync.Mutex
+	m map[string]treeCache
+}{m: make(map[string]treeCache)}
+
+// Get the tree below root for a page, rebuilding it after cacheTimeout
+// Each page gets its own copy, since mountLinks rewrites the paths in it
+func cachedTree(r *http.Request, root string, depth int) []Link {
+	key := root + "\x00" + strconv.Itoa(depth) + "\x00" + absURL(r, "/") + "\x00" + requestBlocks(r).cacheCountry()
+	trees.Lock()
+	tc, ok := trees.m[key]
+	trees.Unlock()
+	if *noCache || !ok || !tc.ts.After(time.Now().Add(-*cacheTimeout)) {
+		tc = treeCache{links: dirTree(r, root, depth), ts: time.Now()}
+		trees.Lock()
+		trees.m[key] = tc
+		trees.Unlock()
+	}
+	return copyTree(tc.links)
+}
+
+func copyTree(links []Link) []Link {
+	if links == nil {
+		return nil
+	}
+	out := make([]Link, len(links))
+	copy(out, links)
+	for i := range out {
+		out[i].Children = copyTree(out[i].Children)
+	}
+	return out
+}
+
+type childCountCache struct {
+	n  int
+	ts time.Time
+}
+
+// Entry counts of directories by path and any country blocked.txt has rules
+// for, so listing a directory doesn't list every directory in it each time,
+// and no count includes pages blocked for its reader
+var childCounts = struct {
+	sync.Mutex
+	m map[string]childCountCache
+}{m: make(map[string]childCountCache)}
+
+// Count the entries a directory lists, recounting after cacheTimeout
+func childCount(r *http.Request, path string) int {
+	key := path + "\x00" + requestBlocks(r).cacheCountry()
+	childCounts.Lock()
+	cc, ok := childCounts.m[key]
+	childCounts.Unlock()
+	if !*noCache && ok && cc.ts.After(time.Now().Add(-*cacheTimeout)) {
+		return cc.n
+	}
+	links, _ := listDir(r, path)
+	cc = childCountCache{n: len(links), ts: time.Now()}
+	childCounts.Lock()
+	childCounts.m[key] = cc
+	childCounts.Unlock()
+	return cc.n
+}
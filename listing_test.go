@@ -0,0 +1,267 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The titles of a listing, in order
+func listingTitles(body string) []string {
+	var titles []string
+	for _, entry := range strings.Split(body, "[")[1:] {
+		title, _, _ := strings.Cut(entry, "|")
+		titles = append(titles, title)
+	}
+	return titles
+}
+
+func TestListingOrderDescending(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/blog/_index.md": "---\nsort: date\norder: desc\n---\n",
+		"h/pub/blog/old.md":    "---\ndate: 2020-01-01\n---\n",
+		"h/pub/blog/new.md":    "---\ndate: 2022-01-01\n---\n",
+		"h/pub/blog/mid.md":    "---\ndate: 2021-01-01\n---\n",
+	})
+	if got := strings.Join(listingTitles(getPage("/blog/").Body.String()), ","); got != "New,Mid,Old" {
+		t.Errorf("_index order: desc listed %s", got)
+	}
+	if got := strings.Join(listingTitles(getPage("/blog/?order=asc").Body.String()), ","); got != "Old,Mid,New" {
+		t.Errorf("?order=asc listed %s", got)
+	}
+}
+
+func TestListingPages(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/dir.html": "<d>{{range .Dir}}[{{.Title}}|{{.Path}}]{{end}}{{.PrevPage}}|{{.NextPage}}</d>",
+		"h/pub/blog/_index.md": "---\nsort: date\norder: desc\nper: 2\n---\n",
+		"h/pub/blog/a.md":      "---\ndate: 2020-01-01\n---\n",
+		"h/pub/blog/b.md":      "---\ndate: 2023-01-01\n---\n",
+		"h/pub/blog/c.md":      "---\ndate: 2022-01-01\n---\n",
+	})
+	body := getPage("/blog/").Body.String()
+	if got := strings.Join(listingTitles(body), ","); got != "B,C" || !strings.Contains(body, "|/blog/?page=2</d>") {
+		t.Errorf("first page: %s", body)
+	}
+	body = getPage("/blog/?page=2").Body.String()
+	if got := strings.Join(listingTitles(body), ","); got != "A" || !strings.Contains(body, "/blog/?page=1|</d>") {
+		t.Errorf("second page: %s", body)
+	}
+	for _, target := range []string{"/blog/?page=3", "/blog/?per=4611686018427387904&page=3"} {
+		if w := getPage(target); w.Code != http.StatusNotFound {
+			t.Errorf("%s got status %d, want 404", target, w.Code)
+		}
+	}
+}
+
+func TestListingPerClamped(t *testing.T) {
+	opts := listingOptions(httptest.NewRequest("GET", "/?per=1000000", nil), nil)
+	if opts.Per != maxPer {
+		t.Errorf("per is %d", opts.Per)
+	}
+	links := make([]Link, 5)
+	huge := listing{Per: maxPer, Page: 1 << 62}
+	if got, more := huge.arrange(links); got != nil || more {
+		t.Errorf("page past the end gave %v, %v", got, more)
+	}
+}
+
+func TestListingTitle(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/dir.html":  "[{{.Title}}|{{.Description}}]",
+		"h/pub/docs/_index.md":  "---\ntitle: The Docs\ndescription: All of them\n---\n",
+		"h/pub/blog_posts/x.md": "x",
+	})
+	for target, want := range map[string]string{
+		"/docs/":       "[The Docs|All of them]",
+		"/blog_posts/": "[Blog Posts|]",
+	} {
+		if body := getPage(target).Body.String(); !strings.Contains(body, want) {
+			t.Errorf("%s got %q, want it to contain %q", target, body, want)
+		}
+	}
+}
+
+func TestDirSummaries(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/dir.html": "{{range .Dir}}[{{.Title}}|{{.Summary}}]{{end}}",
+		"h/pub/d/a.md":         "---\ntitle: Alpha\n---\n# Head\n\nSome *text* here.",
+		"h/pub/d/b.md":         "---\ndescription: Bee page\n---\nb",
+	})
+	setFlag(t, dirSummaries, true)
+	body := getPage("/d/").Body.String()
+	for _, want := range []string{"[Alpha|Head Some text here.]", "[B|Bee page]"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got %q, want it to contain %q", body, want)
+		}
+	}
+}
+
+func TestSummaryBelow(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/above/_index.md": "Prose",
+		"h/pub/above/a.md":      "a",
+		"h/pub/below/_index.md": "---\nsummary_below: true\n---\nProse",
+		"h/pub/below/a.md":      "a",
+	})
+	for target, want := range map[string]string{
+		"/above/": "<h>Above</h><v><p>Prose</p>\n</v><d>[A|/above/a]</d><f></f>",
+		"/below/": "<h>Below</h><d>[A|/below/a]</d><v><p>Prose</p>\n</v><f></f>",
+	} {
+		if body := getPage(target).Body.String(); body != want {
+			t.Errorf("%s got %q, want %q", target, body, want)
+		}
+	}
+}
+
+func TestHiddenPage(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/d/a.md": "---\ntitle: A\nhidden: true\ndate: 2024-01-01\n---\nsecret",
+		"h/pub/d/b.md": "---\ntitle: B\ndate: 2024-01-01\n---\nb",
+	})
+	if w := getPage("/d/a"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("hidden page got status %d: %q", w.Code, w.Body.String())
+	}
+	if got := strings.Join(listingTitles(getPage("/d/").Body.String()), ","); got != "B" {
+		t.Errorf("listing has %s", got)
+	}
+	if feed := getPage("/d/feed.xml").Body.String(); strings.Contains(feed, "<title>A</title>") || !strings.Contains(feed, "<title>B</title>") {
+		t.Errorf("hidden page in feed: %s", feed)
+	}
+}
+
+func TestPreferDirs(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/docs.md":         "docs page",
+		"h/pub/docs/a.md":       "a",
+		"h/pub/guide.md":        "guide page",
+		"h/pub/guide/_index.md": "guide index",
+		"h/pub/guide/b.md":      "b",
+	})
+	if body := getPage("/docs").Body.String(); body != "<h></h><v><p>docs page</p>\n</v><f></f>" {
+		t.Errorf("without -preferDirs got %q", body)
+	}
+	setFlag(t, preferDirs, true)
+	for target, want := range map[string]string{
+		// docs.md stands in for a missing _index.md
+		"/docs":  "<h>Docs</h><v><p>docs page</p>\n</v><d>[A|/docs/a]</d><f></f>",
+		"/docs/": "<h>Docs</h><v><p>docs page</p>\n</v><d>[A|/docs/a]</d><f></f>",
+		// and _index.md wins over it
+		"/guide": "<h>Guide</h><v><p>guide index</p>\n</v><d>[B|/guide/b]</d><f></f>",
+	} {
+		if body := getPage(target).Body.String(); body != want {
+			t.Errorf("%s got %q, want %q", target, body, want)
+		}
+	}
+}
+
+func TestTree(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/view.html": `<v>{{define "t"}}<ul>{{range .}}<li>{{.Path}}{{with .Children}}{{template "t" .}}{{end}}</li>{{end}}</ul>{{end}}{{template "t" .Tree}}</v>`,
+		"h/pub/a.md":            "a",
+		"h/pub/d/b.md":          "b",
+		"h/pub/d/e/c.md":        "c",
+		"h/pub/d/x.md":          "---\ndraft: true\n---\nx",
+		"h/pub/d/y.md":          "---\nhidden: true\n---\ny",
+	})
+	setFlag(t, treeDepth, 2)
+	setFlag(t, cacheTimeout, time.Hour)
+	want := "<v><ul><li>/a</li><li>/d/<ul><li>/d/b</li><li>/d/e/</li></ul></li></ul></v>"
+	if body := getPage("/a").Body.String(); !strings.Contains(body, want) {
+		t.Errorf("got %q, want it to contain %q", body, want)
+	}
+	// the tree is cached rather than walked again for every page
+	if err := os.WriteFile("h/pub/new.md", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if body := getPage("/d/b").Body.String(); !strings.Contains(body, want) {
+		t.Errorf("cached tree got %q", body)
+	}
+	setFlag(t, noCache, true)
+	if body := getPage("/a").Body.String(); !strings.Contains(body, "<li>/new</li>") {
+		t.Errorf("-noCache tree got %q", body)
+	}
+}
+
+func TestTreeUnderMount(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/view.html": `<v>{{range .Tree}}[{{.Path}}]{{end}}</v>`,
+		"h/pub/a.md":            "a",
+	})
+	setFlag(t, treeDepth, 1)
+	setFlag(t, &mounts, []mount{{Host: testHost, Prefix: "/m", Site: testHost}})
+	h := withMounts(http.HandlerFunc(pageHandler))
+	// rewriting one page's links for its mount doesn't touch the cached tree
+	for i := 0; i < 2; i++ {
+		if body := request(h, http.MethodGet, "/m/a", nil).Body.String(); !strings.Contains(body, "<v>[/m/a]</v>") {
+			t.Errorf("request %d got %q", i, body)
+		}
+	}
+	if body := getPage("/a").Body.String(); !strings.Contains(body, "<v>[/a]</v>") {
+		t.Errorf("unmounted got %q", body)
+	}
+}
+
+func TestChildCounts(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a/x.md":         "x",
+		"h/pub/a/y.md":         "---\ndraft: true\n---\ny",
+		"h/pub/a/_index.md":    "i",
+		"h/pub/a/.hidden":      "h",
+		"h/pub/a/b/z.md":       "z",
+		"h/pub/a/b/w.txt":      "w",
+		"h/pub/e/.keep":        "",
+		"h/templates/dir.html": "{{range .Dir}}[{{.Path}}={{.Count}}]{{end}}",
+	})
+	for target, want := range map[string]string{
+		"/":   "[/a/=2][/e/=0]",
+		"/a/": "[/a/b/=2][/a/x=0]",
+	} {
+		if body := getPage(target).Body.String(); !strings.Contains(body, want) {
+			t.Errorf("%s got %q, want %q", target, body, want)
+		}
+	}
+}
+
+func TestPinned(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":           "---\ndate: 2024-01-01\n---\na",
+		"h/pub/b.md":           "---\ndate: 2024-01-05\npinned: true\n---\nb",
+		"h/pub/c.md":           "---\ndate: 2024-01-03\n---\nc",
+		"h/pub/d.md":           "---\ndate: 2024-01-09\npinned: true\n---\nd",
+		"h/pub/e.md":           "---\ndate: 2024-01-07\n---\ne",
+		"h/templates/dir.html": "{{range .Dir}}[{{.Path}}{{if .Pinned}}*{{end}}]{{end}}",
+	})
+	for target, want := range map[string]string{
+		"/":                        "[/d*][/b*][/a][/c][/e]",
+		"/?sort=date&order=desc":   "[/d*][/b*][/e][/c][/a]",
+		"/?sort=date&per=3&page=2": "[/c][/e]",
+	} {
+		if body := getPage(target).Body.String(); !strings.Contains(body, want) {
+			t.Errorf("%s got %q, want %q", target, body, want)
+		}
+	}
+}
+
+func TestListingFields(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/dir.html": "{{range .Dir}}[{{.Title}}|{{.Path}}|{{.Author.Name}}|{{.Author.Avatar}}|{{range .Tags}}{{.}};{{end}}|{{.Summary}}]{{end}}",
+		"h/pub/blog/a.md":      "---\ntitle: Alpha\nauthor:\n  name: Ann\n  avatar: ann.png\ntags: [go, web]\ndescription: About a\ndate: 2024-01-02\n---\na",
+		"h/pub/blog/b.md":      "b",
+	})
+	setFlag(t, dirSummaries, true)
+	body := getPage("/blog/").Body.String()
+	if want := "[Alpha|/blog/a|Ann|http://h/blog/ann.png|go;web;|About a][B|/blog/b||||b]"; !strings.Contains(body, want) {
+		t.Errorf("got %q, want %q", body, want)
+	}
+	links, err := loadDir(hostRequest("/blog/"), "h/pub/blog")
+	if err != nil || len(links) != 2 {
+		t.Fatalf("got %v, %v", links, err)
+	}
+	if !links[0].Date.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("date got %s", links[0].Date)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/websocket"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sync"
+)
+
+const liveReloadPath = "/_livereload"
+
+// Injected into rendered pages in -liveReload mode
+const liveReloadScript = `<script>
+(function() {
+	var proto = location.protocol == "https:" ? "wss://" : "ws://";
+	var ws = new WebSocket(proto + location.host + "` + liveReloadPath + `");
+	ws.onmessage = function() { location.reload(); };
+})();
+</script>
+`
+
+// Browsers currently waiting to be told to reload
+var reloadClients = struct {
+	sync.Mutex
+	m map[chan struct{}]bool
+}{m: make(map[chan struct{}]bool)}
+
+// Tell every connected browser to reload
+func notifyReload() {
+	reloadClients.Lock()
+	defer reloadClients.Unlock()
+	for c := range reloadClients.m {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Hold a websocket open and send a message on every content change
+func liveReloadHandler(ws *websocket.Conn) {
+	c := make(chan struct{}, 1)
+	reloadClients.Lock()
+	reloadClients.m[c] = true
+	reloadClients.Unlock()
+	defer func() {
+		reloadClients.Lock()
+		delete(reloadClients.m, c)
+		reloadClients.Unlock()
+	}()
+	// Reads only fail once the browser goes away
+	closed := make(chan struct{})
+	go func() {
+		var msg string
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+		close(closed)
+	}()
+	for {
+		select {
+		case <-c:
+			if err := websocket.Message.Send(ws, "reload"); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Watch every directory in the content roots and reload browsers on changes
+func watchContent() (*fsnotify.Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range contentRoots() {
+		watchTree(w, root)
+	}
+	go func() {
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				// logging a request mustn't reload the page that made it
+				if isAccessLog(ev.Name) {
+					continue
+				}
+				// fsnotify isn't recursive, so pick up new directories as they appear
+				if ev.Op&fsnotify.Create != 0 {
+					watchTree(w, ev.Name)
+				}
+				notifyReload()
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Println("Watcher error:", err)
+			}
+		}
+	}()
+	return w, nil
+}
+
+// Add dir and every directory below it to the watcher
+func watchTree(w *fsnotify.Watcher, dir string) {
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if err := w.Add(p); err != nil {
+			log.Println("Couldn't watch", p, err)
+		}
+		return nil
+	})
+}
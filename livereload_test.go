@@ -0,0 +1,72 @@
+package main
+
+import (
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Watch the test site and connect a browser to be told to reload
+func reloadClient(t *testing.T) *websocket.Conn {
+	t.Helper()
+	watcher, err := watchContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { watcher.Close() })
+	srv := httptest.NewServer(websocket.Handler(liveReloadHandler))
+	t.Cleanup(srv.Close)
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+liveReloadPath, "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	// wait for the handler to start listening for changes
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		reloadClients.Lock()
+		n := len(reloadClients.m)
+		reloadClients.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client never registered")
+		}
+	}
+	return ws
+}
+
+func TestLiveReload(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a"})
+	ws := reloadClient(t)
+	if err := os.WriteFile("h/pub/a.md", []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg != "reload" {
+		t.Errorf("got message %q", msg)
+	}
+}
+
+// Logging the request for a page mustn't reload it
+func TestLiveReloadSkipsAccessLog(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a", "h/wurk.yaml": "access_log: access.log\n"})
+	ws := reloadClient(t)
+	request(logAccess(http.HandlerFunc(pageHandler)), http.MethodGet, "/a", nil)
+	if log, err := os.ReadFile("h/access.log"); err != nil || !strings.Contains(string(log), "GET /a") {
+		t.Fatalf("access log has %q: %v", log, err)
+	}
+	ws.SetDeadline(time.Now().Add(500 * time.Millisecond))
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err == nil {
+		t.Errorf("got message %q", msg)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// An entry in the site manifest
+type manifestEntry struct {
+	URL      string   `json:"url"`
+	Title    string   `json:"title"`
+	Tags     []string `json:"tags"`
+	Modified string   `json:"modified"`
+}
+
+// Serve every listed page of the host as JSON, in URL order, for tools
+// finding their way around the site
+// It's built from the site cache, so it's as fresh as -cacheTimeout
+func manifestHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkDomain(w, r); err != nil {
+		return
+	}
+	entries := []manifestEntry{}
+	var newest time.Time
+	for _, p := range sitePages(r) {
+		if !listed(p.Info) {
+			continue
+		}
+		tags := p.Info.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		entries = append(entries, manifestEntry{
+			URL:      prefixURL(mountPrefix(r), p.URL),
+			Title:    pageTitle(p),
+			Tags:     tags,
+			Modified: p.ModTime.UTC().Format(time.RFC3339),
+		})
+		if p.ModTime.After(newest) {
+			newest = p.ModTime
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	out, err := json.Marshal(entries)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Could not build manifest.")
+		logRequest(r, err)
+		return
+	}
+	sum := sha256.Sum256(out)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeContent(w, r, "manifest.json", newest, bytes.NewReader(out))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":       "---\ntitle: Alpha\ntags: [go, web]\n---\na",
+		"h/pub/d/b.md":     "b",
+		"h/pub/d/index.md": "i",
+		"h/pub/c.md":       "---\ndraft: true\n---\nc",
+		"h/pub/e.md":       "---\nhidden: true\n---\ne",
+	})
+	w := request(http.HandlerFunc(manifestHandler), "GET", "/manifest.json", nil)
+	var entries []manifestEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err, w.Body.String())
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.URL+" "+e.Title)
+		if len(e.Modified) == 0 {
+			t.Errorf("%s has no modified time", e.URL)
+		}
+	}
+	want := []string{"/a Alpha", "/d/ D", "/d/b B"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d got %q, want %q", i, got[i], want[i])
+		}
+	}
+	if tags := entries[0].Tags; len(tags) != 2 || tags[0] != "go" || tags[1] != "web" {
+		t.Errorf("tags got %q", tags)
+	}
+	etag := w.Header().Get("ETag")
+	if w := request(http.HandlerFunc(manifestHandler), "GET", "/manifest.json", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("unchanged manifest got %d", w.Code)
+	}
+}
+
+func TestManifestSiteFile(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":          "a",
+		"h/pub/manifest.json": `{"name":"app"}`,
+	})
+	if w := getPage("/manifest.json"); w.Body.String() != `{"name":"app"}` {
+		t.Errorf("site manifest.json not served: %d %s", w.Code, w.Body.String())
+	}
+	os.Remove(filepath.Join("h", "pub", "manifest.json"))
+	var entries []manifestEntry
+	if w := getPage("/manifest.json"); json.Unmarshal(w.Body.Bytes(), &entries) != nil || len(entries) != 1 {
+		t.Errorf("page manifest not served without the file: %d %s", w.Code, w.Body.String())
+	}
+}
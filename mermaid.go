@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/russross/blackfriday/v2"
+	"html/template"
+	"io"
+)
+
+// Loads mermaid from a CDN and draws every diagram on the page
+const mermaidScript = `<script type="module">
+import mermaid from "https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.esm.min.mjs";
+mermaid.initialize({ startOnLoad: true });
+</script>
+`
+
+const mermaidClass = `<div class="mermaid">`
+
+// A renderer that leaves mermaid code blocks for the browser to draw
+type mermaidRenderer struct {
+	*blackfriday.HTMLRenderer
+}
+
+func (m mermaidRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if node.Type == blackfriday.CodeBlock && string(node.Info) == "mermaid" {
+		io.WriteString(w, mermaidClass+template.HTMLEscapeString(string(node.Literal))+"</div>\n")
+		return blackfriday.GoToNext
+	}
+	return m.HTMLRenderer.RenderNode(w, node, entering)
+}
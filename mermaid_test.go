@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMermaid(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/footer.html": "<f></f></body>",
+		"h/pub/a.md":              "```mermaid\ngraph TD\n  A-->B & C\n  *x*\n```\n\n```go\nx := 1\n```\n",
+	})
+	setFlag(t, mermaid, true)
+	body := getPage("/a").Body.String()
+	if want := "<div class=\"mermaid\">graph TD\n  A--&gt;B &amp; C\n  *x*\n</div>"; !strings.Contains(body, want) {
+		t.Errorf("got %q, want it to contain %q", body, want)
+	}
+	if !strings.Contains(body, `<code class="language-go">`) {
+		t.Errorf("other code blocks changed: %q", body)
+	}
+	if !strings.Contains(body, "mermaid.initialize") {
+		t.Errorf("no mermaid script: %q", body)
+	}
+}
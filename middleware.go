@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	mountKey
+	langKey
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// Tag each request with an ID, either the one a proxy handed us or a fresh one
+// The ID is echoed back so clients can correlate responses with our logs
+func withRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Only accept short, printable IDs so a client can't forge log lines
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Turn a panicking handler into a 500 for its request alone
+// The stack goes to the log, tagged with the request's ID
+func recoverPanics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			logRequest(r, "panic serving", r.URL.Path+":", err, "\n"+string(debug.Stack()))
+			renderError(w, r, http.StatusInternalServerError, "Internal server error.")
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Cap how much of a request body handlers can read at -maxBodyBytes
+func limitBody(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, *maxBodyBytes)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Refuse requests using any method but the given ones
+// Handlers that accept writes opt in by listing POST
+func allowMethods(h http.Handler, methods ...string) http.Handler {
+	allow := strings.Join(methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range methods {
+			if r.Method == m {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", allow)
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+	})
+}
+
+// Only allow requests that read
+func readOnly(h http.HandlerFunc) http.Handler {
+	return allowMethods(h, http.MethodGet, http.MethodHead)
+}
+
+// Get the ID assigned to a request, if any
+func requestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// log.Println, but prefixed with the request's ID
+func logRequest(r *http.Request, v ...interface{}) {
+	if id := requestID(r); id != "" {
+		v = append([]interface{}{"[" + id + "]"}, v...)
+	}
+	log.Println(v...)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+	}))
+
+	w := request(h, http.MethodGet, "/", map[string]string{requestIDHeader: "abc-123"})
+	if got := w.Header().Get(requestIDHeader); got != "abc-123" {
+		t.Errorf("incoming ID echoed as %q", got)
+	}
+	if seen != "abc-123" {
+		t.Errorf("handler saw ID %q", seen)
+	}
+
+	w = request(h, http.MethodGet, "/", nil)
+	got := w.Header().Get(requestIDHeader)
+	if len(got) == 0 {
+		t.Fatal("no ID generated")
+	}
+	if seen != got {
+		t.Errorf("handler saw ID %q, response has %q", seen, got)
+	}
+}
+
+func TestRequestIDLogged(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md": "---\nstatus: 42\nexpires: soon\n---\n{{< nope >}}",
+	})
+	setFlag(t, strictShortcodes, true)
+	// the site walk logs the same warnings, with no request to name
+	getPage("/a")
+	logged := captureLog(t)
+	request(withRequestID(http.HandlerFunc(pageHandler)), http.MethodGet, "/a", map[string]string{requestIDHeader: "req-2"})
+	lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+	if len(lines) < 3 {
+		t.Fatalf("expected status, expires and shortcode warnings: %s", logged)
+	}
+	for _, l := range lines {
+		if !strings.Contains(l, "[req-2]") {
+			t.Errorf("logged without its request ID: %s", l)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a"})
+	h := readOnly(pageHandler)
+	for method, want := range map[string]int{
+		http.MethodGet:  http.StatusOK,
+		http.MethodHead: http.StatusOK,
+		http.MethodPost: http.StatusMethodNotAllowed,
+		http.MethodPut:  http.StatusMethodNotAllowed,
+	} {
+		w := request(h, method, "/a", nil)
+		if w.Code != want {
+			t.Errorf("%s got status %d, want %d", method, w.Code, want)
+		}
+		if want == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("%s got Allow %q", method, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/500.html": "<e>{{.Page}}</e>",
+		"h/pub/a.md":           "a",
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/boom", func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["x"] = 1
+	})
+	mux.HandleFunc("/", pageHandler)
+	h := withRequestID(recoverPanics(mux))
+	logged := captureLog(t)
+
+	w := request(h, http.MethodGet, "/boom", map[string]string{requestIDHeader: "req-1"})
+	if w.Code != http.StatusInternalServerError || w.Body.String() != "<e>Internal server error.</e>" {
+		t.Errorf("got status %d: %q", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logged.String(), "req-1") || !strings.Contains(logged.String(), "goroutine") {
+		t.Errorf("panic logged without its request ID or stack: %s", logged)
+	}
+	if w := request(h, http.MethodGet, "/a", nil); w.Code != http.StatusOK {
+		t.Errorf("after a panic got status %d", w.Code)
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	setFlag(t, maxHeaderBytes, 1024)
+	setFlag(t, maxBodyBytes, 10)
+	var readErr error
+	srv := httptest.NewUnstartedServer(limitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	})))
+	srv.Config.MaxHeaderBytes = *maxHeaderBytes
+	srv.Start()
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("X-Big", strings.Repeat("x", 10000))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("oversized headers got status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(srv.URL, "text/plain", strings.NewReader(strings.Repeat("x", 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	var tooBig *http.MaxBytesError
+	if !errors.As(readErr, &tooBig) {
+		t.Errorf("oversized body read gave %v", readErr)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Parse ext=type mappings separated by commas or newlines
+// Blank entries and # comments are skipped
+func parseMimeTypes(list string) map[string]string {
+	types := make(map[string]string)
+	for _, entry := range strings.FieldsFunc(list, func(c rune) bool { return c == ',' || c == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 || entry[0] == '#' {
+			continue
+		}
+		ext, typ, ok := strings.Cut(entry, "=")
+		ext, typ = strings.TrimSpace(ext), strings.TrimSpace(typ)
+		if !ok || len(ext) == 0 || len(typ) == 0 {
+			continue
+		}
+		if ext[0] != '.' {
+			ext = "." + ext
+		}
+		types[strings.ToLower(ext)] = typ
+	}
+	return types
+}
+
+// Look up a content type for filename from the host's mimetypes file,
+// then -mimeTypes, leaving anything else to the standard library
+func mimeType(r *http.Request, filename string) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if len(ext) == 0 {
+		return "", false
+	}
+	if contents, err := readFile(filepath.Join(siteHost(r), "mimetypes")); err == nil {
+		if typ, ok := parseMimeTypes(string(contents))[ext]; ok {
+			return typ, true
+		}
+	}
+	typ, ok := parseMimeTypes(*mimeTypes)[ext]
+	return typ, ok
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestMimeTypes(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/mimetypes":  "# types for this host\nfoo = text/foo\n",
+		"h/pub/a.avif": "a",
+		"h/pub/b.foo":  "b",
+		"h/pub/c.css":  "c",
+	})
+	setFlag(t, mimeTypes, "avif=image/avif,.css=text/x-css")
+	for target, want := range map[string]string{
+		"/a.avif": "image/avif",
+		"/b.foo":  "text/foo",
+		"/c.css":  "text/x-css",
+	} {
+		if got := getPage(target).Header().Get("Content-Type"); got != want {
+			t.Errorf("%s got Content-Type %q, want %q", target, got, want)
+		}
+	}
+}
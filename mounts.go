@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A site served under a path prefix of a host
+// Site is the host directory holding its pub and templates
+type mount struct {
+	Host   string
+	Prefix string
+	Site   string
+}
+
+var mounts []mount
+
+// Read a -mounts file of "host/prefix site" lines
+// Blank lines and # comments are skipped
+func loadMounts(filename string) ([]mount, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ms []mount
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a host/prefix and a site", filename, n)
+		}
+		host, prefix, _ := strings.Cut(fields[0], "/")
+		prefix = "/" + strings.Trim(prefix, "/")
+		if prefix == "/" {
+			return nil, fmt.Errorf("%s:%d: %s has no prefix", filename, n, fields[0])
+		}
+		ms = append(ms, mount{Host: host, Prefix: prefix, Site: fields[1]})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	// the longest prefix wins
+	sort.SliceStable(ms, func(i, j int) bool {
+		return len(ms[i].Prefix) > len(ms[j].Prefix)
+	})
+	return ms, nil
+}
+
+// Hand requests under a mounted prefix to its site, with the prefix stripped
+func withMounts(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range mounts {
+			if !strings.EqualFold(m.Host, r.Host) {
+				continue
+			}
+			rest, ok := strings.CutPrefix(r.URL.Path, m.Prefix)
+			if !ok || (len(rest) > 0 && rest[0] != '/') {
+				continue
+			}
+			if len(rest) == 0 {
+				http.Redirect(w, r, m.Prefix+"/", http.StatusMovedPermanently)
+				return
+			}
+			r2 := r.Clone(context.WithValue(r.Context(), mountKey, m))
+			r2.URL.Path = rest
+			r2.URL.RawPath = ""
+			h.ServeHTTP(w, r2)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func requestMount(r *http.Request) (mount, bool) {
+	m, ok := r.Context().Value(mountKey).(mount)
+	return m, ok
+}
+
+// Get the host directory serving a request
+func siteHost(r *http.Request) string {
+	if m, ok := requestMount(r); ok {
+		return m.Site
+	}
+	return r.Host
+}
+
+// Get the prefix a request's site is mounted under, if any
+func mountPrefix(r *http.Request) string {
+	m, _ := requestMount(r)
+	return m.Prefix
+}
+
+// Put the mount and language prefixes back on the links a page is given,
+// since handlers only ever see paths relative to the site
+func mountLinks(r *http.Request, info *PageInfo) {
+	if len(mountPrefix(r)) == 0 && len(requestLanguage(r)) == 0 {
+		return
+	}
+	for _, links := range [][]Link{info.BreadCrumb, info.Dir, info.Recent, info.Featured, info.Suggestions} {
+		for i := range links {
+			links[i].Path = siteURL(r, links[i].Path)
+		}
+	}
+	prefixTree(r, info.Tree)
+	for _, l := range []*Link{info.SeriesNav.Prev, info.SeriesNav.Next} {
+		if l != nil {
+			l.Path = siteURL(r, l.Path)
+		}
+	}
+	for i := range info.Gallery {
+		info.Gallery[i].Thumb = siteURL(r, info.Gallery[i].Thumb)
+		info.Gallery[i].Full = siteURL(r, info.Gallery[i].Full)
+	}
+	info.PrevPage = siteURL(r, info.PrevPage)
+	info.NextPage = siteURL(r, info.NextPage)
+}
+
+func prefixTree(r *http.Request, links []Link) {
+	for i := range links {
+		links[i].Path = siteURL(r, links[i].Path)
+		prefixTree(r, links[i].Children)
+	}
+}
+
+func prefixURL(prefix, u string) string {
+	if len(u) == 0 || u[0] != '/' {
+		return u
+	}
+	return prefix + u
+}
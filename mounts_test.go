@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMounts(t *testing.T) {
+	files := map[string]string{
+		"mounts":        "# tenants\nh/tenantA ta\nh/tenantB/ tb\n",
+		"ta/pub/x.md":   "---\ntitle: TA\n---\nA",
+		"tb/pub/x.md":   "B",
+		"tb/pub/d/y.md": "y",
+	}
+	for name, contents := range testTemplates {
+		files["ta"+strings.TrimPrefix(name, testHost)] = contents
+		files["tb"+strings.TrimPrefix(name, testHost)] = contents
+	}
+	newSite(t, files)
+	captureLog(t)
+	ms, err := loadMounts("mounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, &mounts, ms)
+	h := withMounts(http.HandlerFunc(pageHandler))
+	for target, want := range map[string]string{
+		"/tenantA/x":  "<h>TA</h><v><p>A</p>",
+		"/tenantB/x":  "<h></h><v><p>B</p>",
+		"/tenantB/d/": "[Y|/tenantB/d/y]",
+	} {
+		w := request(h, http.MethodGet, target, nil)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s got status %d: %q, want it to contain %q", target, w.Code, w.Body.String(), want)
+		}
+	}
+	if w := request(h, http.MethodGet, "/tenantA", nil); w.Header().Get("Location") != "/tenantA/" {
+		t.Errorf("bare prefix got status %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	// only whole path segments match a prefix
+	if w := request(h, http.MethodGet, "/tenantAx/x", nil); w.Code != http.StatusNotFound {
+		t.Errorf("/tenantAx/x got status %d", w.Code)
+	}
+}
+
+func TestLoadMountsErrors(t *testing.T) {
+	newSite(t, map[string]string{
+		"noprefix": "h ta\n",
+		"nosite":   "h/a\n",
+	})
+	for _, name := range []string{"noprefix", "nosite", "missing"} {
+		if _, err := loadMounts(name); err == nil {
+			t.Errorf("%s loaded", name)
+		}
+	}
+}
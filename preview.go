@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sign a URL path so an unpublished page there can be previewed
+// A non-zero expiry is folded into the signature and appended to the token
+func previewToken(path string, expiry time.Time) string {
+	msg := path
+	suffix := ""
+	if !expiry.IsZero() {
+		unix := strconv.FormatInt(expiry.Unix(), 10)
+		msg += "|" + unix
+		suffix = "." + unix
+	}
+	mac := hmac.New(sha256.New, []byte(*previewSecret))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil)) + suffix
+}
+
+// Check the request's ?preview= token against its path
+func validPreview(r *http.Request) bool {
+	token := r.URL.Query().Get("preview")
+	if len(*previewSecret) == 0 || len(token) == 0 {
+		return false
+	}
+	var expiry time.Time
+	if i := strings.IndexByte(token, '.'); i >= 0 {
+		unix, err := strconv.ParseInt(token[i+1:], 10, 64)
+		if err != nil {
+			return false
+		}
+		expiry = time.Unix(unix, 0)
+		if time.Now().After(expiry) {
+			return false
+		}
+	}
+	return hmac.Equal([]byte(token), []byte(previewToken(r.URL.Path, expiry)))
+}
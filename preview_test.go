@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPreviewToken(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/draft.md": "---\ndraft: true\n---\nsoon"})
+	setFlag(t, previewSecret, "s3cret")
+	for target, want := range map[string]int{
+		"/draft": http.StatusNotFound,
+		"/draft?preview=" + previewToken("/draft", time.Time{}):                       http.StatusOK,
+		"/draft?preview=" + previewToken("/draft", time.Now().Add(time.Hour)):         http.StatusOK,
+		"/draft?preview=" + previewToken("/draft", time.Now().Add(-time.Hour)):        http.StatusNotFound,
+		"/draft?preview=" + previewToken("/elsewhere", time.Time{}):                   http.StatusNotFound,
+		"/draft?preview=0123456789abcdef0123456789abcdef0123456789abcdef0123456789ab": http.StatusNotFound,
+	} {
+		if got := getPage(target).Code; got != want {
+			t.Errorf("%s got status %d, want %d", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Send the source of the page at the extensionless path base, for ?raw=1
+// Front matter is left off unless -rawFrontMatter asks to keep it
+// Returns false if there's no source to send
+func serveSource(w http.ResponseWriter, r *http.Request, base string) bool {
+	patterns := ignorePatterns(getPubRoot(r))
+	for _, ext := range pageExts() {
+		if ignored(patterns, getPubRoot(r), base+ext, false) {
+			continue
+		}
+		if sent, ok := serveSourceFile(w, r, base+ext); ok {
+			return sent
+		}
+	}
+	return false
+}
+
+// Send the page source filename as it would be for ?raw=1
+// ok is false if it can't be read, sent is false if its front matter is broken
+func serveSourceFile(w http.ResponseWriter, r *http.Request, filename string) (sent, ok bool) {
+	contents, err := readFile(filename)
+	if err != nil {
+		return false, false
+	}
+	if !*rawFrontMatter {
+		_, body, err := parseFrontMatter(contents)
+		if err != nil {
+			return false, true
+		}
+		contents = []byte(body)
+	}
+	typ := "text/plain; charset=utf-8"
+	if filepath.Ext(filename) == ".md" {
+		typ = "text/markdown; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", typ)
+	w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Method != http.MethodHead {
+		w.Write(contents)
+	}
+	return true, true
+}
+
+// Send a page source asked for by its extension as a file, like ?raw=1 does
+// Sources of pages kept out of listings are as missing as the pages
+func servePageFile(w http.ResponseWriter, r *http.Request, filename string) {
+	if ignored(ignorePatterns(getPubRoot(r)), getPubRoot(r), filename, false) {
+		fileHandler(w, r)
+		return
+	}
+	f, body, err := readPage(r, filename)
+	if err != nil && !errors.Is(err, errFrontMatter) {
+		fileHandler(w, r)
+		return
+	}
+	empty := *emptyPages == "404" && len(strings.TrimSpace(body)) == 0
+	if err == nil && !empty && listed(NewPageInfo(r, f, siteLocation(r, siteHost(r)))) {
+		if sent, _ := serveSourceFile(w, r, filename); sent {
+			return
+		}
+	}
+	msg := fmt.Sprintf("Could not load %s: File not found", r.URL.Path)
+	renderError(w, r, http.StatusNotFound, msg)
+}
+
+// The extensionless path of the page source pageHandler loaded
+func sourceBase(path string, indexed bool) string {
+	if indexed {
+		return filepath.Join(path, "index")
+	}
+	return trimPageExt(strings.TrimSuffix(path, "/"))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRawSource(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":       "---\ntitle: Secret\n---\n# A\n",
+		"h/pub/d.md":       "---\ndraft: true\n---\nd",
+		"h/pub/b/index.md": "# B\n",
+		"h/pub/h.md":       "---\nhidden: true\n---\nh",
+		"h/pub/e.md":       "",
+	})
+	if w := getPage("/a?raw=1"); w.Header().Get("Content-Type") == "text/markdown; charset=utf-8" {
+		t.Errorf("source sent without -rawSource: %q", w.Body.String())
+	}
+	setFlag(t, rawSource, true)
+	for target, want := range map[string]string{
+		"/a?raw=1":    "# A",
+		"/a.md?raw=1": "# A",
+		"/b/?raw=1":   "# B\n",
+	} {
+		w := getPage(target)
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s got status %d: %q, want %q", target, w.Code, w.Body.String(), want)
+		}
+		if typ := w.Header().Get("Content-Type"); typ != "text/markdown; charset=utf-8" {
+			t.Errorf("%s got Content-Type %q", target, typ)
+		}
+	}
+	if w := getPage("/d?raw=1"); w.Code != http.StatusNotFound {
+		t.Errorf("draft source got status %d", w.Code)
+	}
+	if w := getPage("/h?raw=1"); w.Code != http.StatusNotFound {
+		t.Errorf("hidden source got status %d", w.Code)
+	}
+	setFlag(t, emptyPages, "404")
+	if w := getPage("/e?raw=1"); w.Code != http.StatusNotFound {
+		t.Errorf("empty source got status %d with -emptyPages=404", w.Code)
+	}
+	// without -rawSource only extensionless requests are pages
+	setFlag(t, rawSource, false)
+	if w := getPage("/a.md"); w.Header().Get("Content-Type") != "text/markdown; charset=utf-8" || w.Body.String() != "# A" {
+		t.Errorf("/a.md rendered: %q", w.Body.String())
+	}
+}
+
+func TestRawFrontMatter(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "---\ntitle: Kept\n---\n# A\n"})
+	setFlag(t, rawSource, true)
+	setFlag(t, rawFrontMatter, true)
+	if w := getPage("/a?raw=1"); w.Body.String() != "---\ntitle: Kept\n---\n# A\n" {
+		t.Errorf("got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Get the content roots, in priority order
+// Each root holds host directories, so files in earlier roots shadow later ones
+func contentRoots() []string {
+	var roots []string
+	for _, root := range strings.Split(*rootList, ",") {
+		root = strings.TrimSpace(root)
+		if len(root) > 0 {
+			roots = append(roots, root)
+		}
+	}
+	if len(roots) == 0 {
+		roots = append(roots, ".")
+	}
+	return roots
+}
+
+// Find the first root holding the host relative path rel
+// With -caseInsensitive a path differing only in case will do
+func resolvePath(rel string) (string, os.FileInfo, error) {
+	var err error
+	for _, root := range contentRoots() {
+		var st os.FileInfo
+		p := filepath.Join(root, rel)
+		if st, err = os.Stat(p); err == nil {
+			return p, st, nil
+		}
+		if folded, ok := foldPath(root, rel); ok {
+			if st, ferr := os.Stat(folded); ferr == nil {
+				return folded, st, nil
+			}
+		}
+	}
+	return "", nil, err
+}
+
+// Find rel under root ignoring the case of each part, for -caseInsensitive
+// Parts that exist as given are used as they are
+func foldPath(root, rel string) (string, bool) {
+	if !*caseInsensitive {
+		return "", false
+	}
+	p := root
+	for _, part := range strings.Split(filepath.Clean(rel), string(filepath.Separator)) {
+		next := filepath.Join(p, part)
+		if _, err := os.Lstat(next); err == nil {
+			p = next
+			continue
+		}
+		files, err := os.ReadDir(p)
+		if err != nil {
+			return "", false
+		}
+		found := false
+		for _, f := range files {
+			if strings.EqualFold(f.Name(), part) {
+				p = filepath.Join(p, f.Name())
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return p, true
+}
+
+// Read the host relative file rel from the first root that has it
+func readFile(rel string) ([]byte, error) {
+	p, st, err := resolvePath(rel)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: rel, Err: fs.ErrInvalid}
+	}
+	return os.ReadFile(p)
+}
+
+// Read the host relative directory rel merged across every root
+// Entries are sorted by name, and a name in an earlier root hides it in later ones
+func readDir(rel string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := make(map[string]bool)
+	found := false
+	var err error
+	for _, root := range contentRoots() {
+		var files []fs.DirEntry
+		files, err = os.ReadDir(filepath.Join(root, rel))
+		if folded, ok := foldPath(root, rel); err != nil && ok {
+			files, err = os.ReadDir(folded)
+		}
+		if err != nil {
+			continue
+		}
+		found = true
+		for _, f := range files {
+			if !seen[f.Name()] {
+				entries = append(entries, f)
+				seen[f.Name()] = true
+			}
+		}
+	}
+	if !found {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Walk the host relative directory rel across every root
+// fn is given host relative paths, and is called once per path
+func walkRoots(rel string, fn func(p string, d fs.DirEntry) error) {
+	seen := make(map[string]bool)
+	for _, root := range contentRoots() {
+		base := filepath.Join(root, rel)
+		filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			sub, err := filepath.Rel(base, p)
+			if err != nil {
+				return nil
+			}
+			p = filepath.Join(rel, sub)
+			if seen[p] && !d.IsDir() {
+				return nil
+			}
+			seen[p] = true
+			return fn(p, d)
+		})
+	}
+}
+
+// Find every directory being served as a host
+func listHosts() []string {
+	entries, err := readDir(".")
+	if err != nil {
+		return nil
+	}
+	var hosts []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, st, err := resolvePath(filepath.Join(e.Name(), "pub")); err == nil && st.IsDir() {
+			hosts = append(hosts, e.Name())
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRootsShadowAndMerge(t *testing.T) {
+	newSite(t, map[string]string{
+		"base/h/pub/a.md":     "base a",
+		"base/h/pub/b.md":     "base b",
+		"override/h/pub/a.md": "override a",
+		"override/h/pub/c.md": "override c",
+	})
+	// the test templates are in the working directory
+	setFlag(t, rootList, "override,base,.")
+	if body := getPage("/a").Body.String(); !strings.Contains(body, "override a") {
+		t.Errorf("override root didn't shadow base: %q", body)
+	}
+	if body := getPage("/b").Body.String(); !strings.Contains(body, "base b") {
+		t.Errorf("base page missing: %q", body)
+	}
+	if got := strings.Join(listingTitles(getPage("/").Body.String()), ","); got != "A,B,C" {
+		t.Errorf("merged listing has %s, want A,B,C", got)
+	}
+}
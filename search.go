@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// An entry in the client-side search index
+type searchEntry struct {
+	URL   string   `json:"url"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+	Body  string   `json:"body"`
+}
+
+// Serve every published page of the host as JSON for lunr/fuse style search
+func searchIndexHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkDomain(w, r); err != nil {
+		return
+	}
+	entries := []searchEntry{}
+	for _, p := range sitePages(r) {
+		if !listed(p.Info) {
+			continue
+		}
+		tags := p.Info.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		entries = append(entries, searchEntry{
+			URL:   prefixURL(mountPrefix(r), p.URL),
+			Title: p.Info.Title,
+			Tags:  tags,
+			Body:  plainText(p.HTML),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		logRequest(r, err)
+	}
+}
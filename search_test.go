@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestSearchIndex(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":     "---\ntitle: Apples\ntags: [fruit]\n---\nRed *and* green.",
+		"h/pub/b/c.md":   "---\ntitle: Carrots\n---\nOrange.",
+		"h/pub/draft.md": "---\ntitle: Secret\ndraft: true\n---\nNot yet.",
+	})
+	w := request(http.HandlerFunc(searchIndexHandler), http.MethodGet, "/search-index.json", nil)
+	var entries []searchEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err, w.Body.String())
+	}
+	byURL := make(map[string]searchEntry)
+	for _, e := range entries {
+		byURL[e.URL] = e
+	}
+	if len(byURL) != 2 {
+		t.Errorf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	a := byURL["/a"]
+	if a.Title != "Apples" || len(a.Tags) != 1 || a.Tags[0] != "fruit" || a.Body != "Red and green." {
+		t.Errorf("got /a entry %+v", a)
+	}
+	if byURL["/b/c"].Title != "Carrots" {
+		t.Errorf("missing /b/c: %+v", entries)
+	}
+	if _, ok := byURL["/draft"]; ok {
+		t.Error("draft is in the index")
+	}
+}
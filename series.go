@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Where a page sits in its series
+type SeriesNav struct {
+	Name string
+	Prev *Link
+	Next *Link
+}
+
+// Get the published pages of a series, ordered by weight then date
+func seriesMembers(r *http.Request, name string) []Link {
+	var members []sitePage
+	for _, p := range sitePages(r) {
+		if p.Info.Series == name && visible(p.Info) {
+			members = append(members, p)
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		if members[i].Info.Weight != members[j].Info.Weight {
+			return members[i].Info.Weight < members[j].Info.Weight
+		}
+		return members[i].Date.Before(members[j].Date)
+	})
+	var links []Link
+	for _, p := range members {
+		links = append(links, Link{Title: pageTitle(p), Path: p.URL, Date: p.Date})
+	}
+	return links
+}
+
+// Find the pages either side of the page at url in its series
+func seriesNav(r *http.Request, name, url string) SeriesNav {
+	nav := SeriesNav{Name: name}
+	members := seriesMembers(r, name)
+	url = strings.TrimSuffix(url, "/")
+	for i, m := range members {
+		if strings.TrimSuffix(m.Path, "/") != url {
+			continue
+		}
+		if i > 0 {
+			nav.Prev = &members[i-1]
+		}
+		if i < len(members)-1 {
+			nav.Next = &members[i+1]
+		}
+		break
+	}
+	return nav
+}
+
+// List the members of the series named by /series/<name>
+func seriesHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkDomain(w, r); err != nil {
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/series/"), "/")
+	members := seriesMembers(r, name)
+	if len(name) == 0 || len(members) == 0 {
+		renderError(w, r, http.StatusNotFound, "No such series: "+name)
+		return
+	}
+	info := NewPageInfo(r, nil, siteLocation(r, siteHost(r)))
+	info.Title = name
+	info.BreadCrumb = breadCrumb(r.URL.Path)
+	info.Dir = members
+	setCacheControl(w, r, nil)
+	writePage(w, r, info, "header", "dir", "footer")
+}
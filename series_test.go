@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSeries(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/footer.html": "<f>{{with .SeriesNav.Prev}}prev={{.Title}}{{end}} {{with .SeriesNav.Next}}next={{.Title}}{{end}}</f>",
+		"h/pub/t/a.md":            "---\ntitle: A\nseries: go\nweight: 2\n---\n",
+		"h/pub/t/b.md":            "---\ntitle: B\nseries: go\nweight: 1\n---\n",
+		"h/pub/t/c.md":            "---\ntitle: C\nseries: go\nweight: 3\n---\n",
+	})
+	for target, want := range map[string]string{
+		"/t/b": "<f> next=A</f>",
+		"/t/a": "<f>prev=B next=C</f>",
+		"/t/c": "<f>prev=A </f>",
+	} {
+		if body := getPage(target).Body.String(); !strings.HasSuffix(body, want) {
+			t.Errorf("%s got %q, want it to end %q", target, body, want)
+		}
+	}
+
+	h := readOnly(seriesHandler)
+	w := request(h, http.MethodGet, "/series/go", nil)
+	if got := strings.Join(listingTitles(w.Body.String()), ","); w.Code != http.StatusOK || got != "B,A,C" {
+		t.Errorf("series listing got status %d with %s", w.Code, got)
+	}
+	if w := request(h, http.MethodGet, "/series/nope", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing series got status %d", w.Code)
+	}
+}
+
+func TestSeriesSitePage(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/series/go.md": "own page",
+		"h/pub/t/a.md":       "---\ntitle: A\nseries: rust\n---\n",
+	})
+	if w := getPage("/series/go"); !strings.Contains(w.Body.String(), "own page") {
+		t.Errorf("site page under /series/ not served: %d %s", w.Code, w.Body.String())
+	}
+	if got := strings.Join(listingTitles(getPage("/series/rust").Body.String()), ","); got != "A" {
+		t.Errorf("series without a page listed %q", got)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// A shortcode turns its positional and key="value" arguments into HTML
+type shortcode func(pos []string, named map[string]string) (string, error)
+
+// Shortcodes pages can use as {{< name args >}}
+var shortcodes = map[string]shortcode{
+	"youtube": youtubeShortcode,
+	"figure":  figureShortcode,
+}
+
+var shortcodeTag = regexp.MustCompile(`\{\{<\s*([A-Za-z][\w-]*)(.*?)>\}\}`)
+var shortcodeArg = regexp.MustCompile(`(?:([\w-]+)=)?(?:"([^"]*)"|(\S+))`)
+
+// Replace the shortcodes in a page's source with their HTML
+// Unknown or failing shortcodes are left as they are, or with
+// -strictShortcodes replaced by an error so they can't go unnoticed
+// Shortcodes in fenced code blocks and code spans are shown as they are
+func expandShortcodes(r *http.Request, body string) string {
+	if !strings.Contains(body, "{{<") {
+		return body
+	}
+	return outsideCode(body, func(text string) string {
+		return shortcodeTag.ReplaceAllStringFunc(text, func(tag string) string {
+			return expandShortcode(r, tag)
+		})
+	})
+}
+
+// Expand a single shortcode tag
+func expandShortcode(r *http.Request, tag string) string {
+	m := shortcodeTag.FindStringSubmatch(tag)
+	name := m[1]
+	var pos []string
+	named := make(map[string]string)
+	for _, a := range shortcodeArg.FindAllStringSubmatch(m[2], -1) {
+		val := a[2] + a[3]
+		if len(a[1]) > 0 {
+			named[a[1]] = val
+		} else {
+			pos = append(pos, val)
+		}
+	}
+	var err error
+	if sc, ok := shortcodes[name]; ok {
+		var out string
+		if out, err = sc(pos, named); err == nil {
+			return out
+		}
+	} else {
+		err = fmt.Errorf("unknown shortcode %q", name)
+	}
+	if !*strictShortcodes {
+		return tag
+	}
+	logRequest(r, err)
+	return `<span class="shortcode-error">` + html.EscapeString(err.Error()) + `</span>`
+}
+
+// Run expand over the parts of a markdown source outside its fenced code
+// blocks and code spans, leaving the code as it is
+func outsideCode(body string, expand func(string) string) string {
+	var out, text strings.Builder
+	fence := ""
+	for _, line := range strings.SplitAfter(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(fence) > 0 {
+			out.WriteString(line)
+			if len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if f := codeFence(trimmed); len(f) > 0 && len(line)-len(strings.TrimLeft(line, " ")) < 4 {
+			out.WriteString(outsideSpans(text.String(), expand))
+			text.Reset()
+			out.WriteString(line)
+			fence = f
+			continue
+		}
+		text.WriteString(line)
+	}
+	out.WriteString(outsideSpans(text.String(), expand))
+	return out.String()
+}
+
+// Get the run of backticks or tildes opening a fenced code block, if line is one
+func codeFence(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// Run expand over text outside its code spans, which run from a string of
+// backticks to the next string of as many
+func outsideSpans(s string, expand func(string) string) string {
+	var out, text strings.Builder
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '`')
+		if i < 0 {
+			text.WriteString(s)
+			break
+		}
+		text.WriteString(s[:i])
+		s = s[i:]
+		n := len(s) - len(strings.TrimLeft(s, "`"))
+		end := closingTicks(s[n:], n)
+		if end < 0 {
+			text.WriteString(s[:n])
+			s = s[n:]
+			continue
+		}
+		out.WriteString(expand(text.String()))
+		text.Reset()
+		out.WriteString(s[:n+end+n])
+		s = s[n+end+n:]
+	}
+	out.WriteString(expand(text.String()))
+	return out.String()
+}
+
+// Find where a string of exactly n backticks starts in s, or -1
+func closingTicks(s string, n int) int {
+	for from := 0; from < len(s); {
+		i := strings.IndexByte(s[from:], '`')
+		if i < 0 {
+			return -1
+		}
+		i += from
+		run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+		if run == n {
+			return i
+		}
+		from = i + run
+	}
+	return -1
+}
+
+var youtubeID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// {{< youtube id >}} embeds a YouTube video
+func youtubeShortcode(pos []string, named map[string]string) (string, error) {
+	id := named["id"]
+	if len(id) == 0 && len(pos) > 0 {
+		id = pos[0]
+	}
+	if !youtubeID.MatchString(id) {
+		return "", fmt.Errorf("youtube shortcode needs a video id, not %q", id)
+	}
+	return `<iframe class="youtube" src="https://www.youtube-nocookie.com/embed/` + id +
+		`" allowfullscreen loading="lazy"></iframe>`, nil
+}
+
+// {{< figure src="img.png" caption="Words" alt="Text" >}} shows a captioned image
+func figureShortcode(pos []string, named map[string]string) (string, error) {
+	src := named["src"]
+	if len(src) == 0 && len(pos) > 0 {
+		src = pos[0]
+	}
+	if len(src) == 0 {
+		return "", fmt.Errorf("figure shortcode needs a src")
+	}
+	out := `<figure><img src="` + template.HTMLEscapeString(src) + `" alt="` + template.HTMLEscapeString(named["alt"]) + `">`
+	if caption := named["caption"]; len(caption) > 0 {
+		out += `<figcaption>` + template.HTMLEscapeString(caption) + `</figcaption>`
+	}
+	return out + `</figure>`, nil
+}
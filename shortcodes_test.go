@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShortcodes(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md": "{{< youtube abc123 >}}\n\n{{< figure src=\"p.png\" caption=\"A <b>\" >}}\n\n{{< nope 1 >}}\n",
+	})
+	body := getPage("/a").Body.String()
+	for _, want := range []string{
+		`src="https://www.youtube-nocookie.com/embed/abc123"`,
+		`src="p.png" alt=""`,
+		`<figcaption>A &lt;b&gt;</figcaption>`,
+		`{{&lt; nope 1 &gt;}}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got %q, want it to contain %q", body, want)
+		}
+	}
+}
+
+func TestStrictShortcodes(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "{{< nope 1 >}} and {{< youtube \"bad id\" >}}"})
+	setFlag(t, strictShortcodes, true)
+	captureLog(t)
+	body := getPage("/a").Body.String()
+	if strings.Contains(body, "{{&lt;") || strings.Count(body, `class="shortcode-error"`) != 2 {
+		t.Errorf("got %q", body)
+	}
+	if !strings.Contains(body, "unknown shortcode") {
+		t.Errorf("no error for the unknown shortcode: %q", body)
+	}
+}
+
+func TestShortcodeErrorEscaped(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": `{{< youtube "<img src=x onerror=alert(1)>" >}}`})
+	setFlag(t, strictShortcodes, true)
+	captureLog(t)
+	if body := getPage("/a").Body.String(); strings.Contains(body, "<img") || !strings.Contains(body, "&lt;img") {
+		t.Errorf("error message not escaped: %q", body)
+	}
+}
+
+func TestShortcodesInCode(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md": "Use `{{< youtube abc >}}` like so:\n\n```\n{{< youtube abc >}}\n```\n\n~~~~md\n{{< youtube abc >}}\n~~~~\n\n{{< youtube real >}}\n",
+	})
+	body := getPage("/a").Body.String()
+	if n := strings.Count(body, "<iframe"); n != 1 || !strings.Contains(body, "embed/real") {
+		t.Errorf("expanded %d shortcodes in %q", n, body)
+	}
+	if n := strings.Count(body, "{{&lt; youtube abc &gt;}}"); n != 3 {
+		t.Errorf("%d of 3 shortcodes in code shown as written: %q", n, body)
+	}
+}
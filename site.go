@@ -0,0 +1,241 @@
+package main
+
+import (
+	"golang.org/x/sync/singleflight"
+	"html"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A page found while walking a host's public directory
+type sitePage struct {
+	URL     string
+	File    string
+	Info    PageInfo
+	Body    string
+	HTML    string
+	ModTime time.Time
+	Date    time.Time
+	Dated   bool
+}
+
+// Cache of every page of a host, rebuilt after cacheTimeout
+// permalinks maps each front matter permalink to the page source claiming it
+// dated holds the pages with a front matter date, newest first,
+// and featured the pages marked featured, newest first
+type siteCache struct {
+	pages      []sitePage
+	permalinks map[string]string
+	dated      []sitePage
+	featured   []sitePage
+	ts         time.Time
+}
+
+var sites = struct {
+	sync.Mutex
+	m map[string]siteCache
+	// concurrent misses for a root share one walk
+	loads singleflight.Group
+}{m: make(map[string]siteCache)}
+
+// Builds a site's cache on a miss, so tests can count the walks
+var loadSite = buildSite
+
+// Get every page of the request's site its client may see, using the cache
+// while it's fresh
+// The cache holds every page, so blocked pages are left out on the way out
+func sitePages(r *http.Request) []sitePage {
+	return unblocked(r, cachedSite(getPubRoot(r)).pages)
+}
+
+// Leave out the pages blocked for the request's client, whether blocked.txt
+// names them by their permalink or by where their source is
+func unblocked(r *http.Request, pages []sitePage) []sitePage {
+	blocks := requestBlocks(r)
+	root := getPubRoot(r)
+	var out []sitePage
+	for _, p := range pages {
+		if !blocks.covers(p.URL) && !blocks.covers(pageURL(root, trimPageExt(p.File))) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Get links to the newest published dated pages, for recent post widgets
+func recentPosts(r *http.Request) []Link {
+	var links []Link
+	for _, p := range unblocked(r, cachedSite(getPubRoot(r)).dated) {
+		if len(links) >= *recentCount {
+			break
+		}
+		if listed(p.Info) {
+			links = append(links, Link{Title: pageTitle(p), Path: p.URL, Date: p.Date})
+		}
+	}
+	return links
+}
+
+// Get links to the published pages marked featured, newest first
+func featuredPages(r *http.Request) []Link {
+	var links []Link
+	for _, p := range unblocked(r, cachedSite(getPubRoot(r)).featured) {
+		if listed(p.Info) {
+			links = append(links, Link{Title: pageTitle(p), Path: p.URL, Date: p.Date})
+		}
+	}
+	return links
+}
+
+// Find the page source whose permalink is url
+func permalinkFile(root, url string) (string, bool) {
+	file, ok := cachedSite(root).permalinks[strings.TrimSuffix(url, "/")]
+	return file, ok
+}
+
+// Get the cached pages of a public directory, collecting them again once stale
+func cachedSite(root string) siteCache {
+	sites.Lock()
+	sc, ok := sites.m[root]
+	sites.Unlock()
+	if !*noCache && ok && sc.ts.After(time.Now().Add(-*cacheTimeout)) {
+		return sc
+	}
+	v, _, _ := sites.loads.Do(root, func() (interface{}, error) {
+		sc := loadSite(root)
+		sites.Lock()
+		sites.m[root] = sc
+		sites.Unlock()
+		return sc, nil
+	})
+	return v.(siteCache)
+}
+
+// Collect a public directory's pages and index them
+func buildSite(root string) siteCache {
+	sc := siteCache{pages: collectPages(root), permalinks: map[string]string{}, ts: time.Now()}
+	for _, p := range sc.pages {
+		if len(p.Info.Permalink) > 0 {
+			sc.permalinks[strings.TrimSuffix(p.Info.Permalink, "/")] = p.File
+		}
+		if p.Dated {
+			sc.dated = append(sc.dated, p)
+		}
+		if p.Info.IsFeatured {
+			sc.featured = append(sc.featured, p)
+		}
+	}
+	sort.SliceStable(sc.dated, func(i, j int) bool {
+		return sc.dated[i].Date.After(sc.dated[j].Date)
+	})
+	sort.SliceStable(sc.featured, func(i, j int) bool {
+		return sc.featured[i].Date.After(sc.featured[j].Date)
+	})
+	return sc
+}
+
+// Walk root and load every page source found there
+func collectPages(root string) []sitePage {
+	var pages []sitePage
+	patterns := ignorePatterns(root)
+	loc := siteLocation(nil, filepath.Dir(root))
+	walkRoots(root, func(p string, d fs.DirEntry) error {
+		name := d.Name()
+		if (name[0] == '.' && p != root) || ignored(patterns, root, p, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		base := trimPageExt(p)
+		if d.IsDir() || base == p {
+			return nil
+		}
+		// a directory summary is only the page for its directory without an index
+		if filepath.Base(base) == "_index" && pageExists(filepath.Join(filepath.Dir(base), "index")) {
+			return nil
+		}
+		f, body, err := readPage(nil, p)
+		if err != nil {
+			return nil
+		}
+		st, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rendered := renderBody(nil, filepath.Ext(p), f, body)
+		info := NewPageInfo(nil, f, loc)
+		// undated pages are as new as their last edit
+		date := st.ModTime()
+		dated := hasDate(f)
+		if dated {
+			date = info.RawDate
+		}
+		url := pageURL(root, base)
+		if len(info.Permalink) > 0 {
+			url = info.Permalink
+		}
+		pages = append(pages, sitePage{
+			URL:     url,
+			File:    p,
+			Info:    info,
+			Body:    body,
+			HTML:    string(rendered),
+			ModTime: st.ModTime(),
+			Date:    date,
+			Dated:   dated,
+		})
+		return nil
+	})
+	return pages
+}
+
+// Get a page's title, falling back on its humanized name
+func pageTitle(p sitePage) string {
+	if len(p.Info.Title) > 0 {
+		return p.Info.Title
+	}
+	return humanize(path.Base(p.URL))
+}
+
+// Check whether any page source exists for an extensionless path
+func pageExists(base string) bool {
+	for _, ext := range pageExts() {
+		if _, _, err := resolvePath(base + ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Work out the URL a page source is served at
+func pageURL(root, base string) string {
+	rel, err := filepath.Rel(root, base)
+	if err != nil {
+		return "/"
+	}
+	u := path.Join("/", filepath.ToSlash(rel))
+	switch path.Base(u) {
+	case "index", "_index":
+		u = path.Dir(u)
+		if u != "/" {
+			u += "/"
+		}
+	}
+	return u
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// Reduce rendered HTML to its words
+func plainText(s string) string {
+	s = html.UnescapeString(htmlTag.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecentPosts(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/footer.html": "<f>{{range .Recent}}[{{.Title}}|{{.Path}}]{{end}}</f>",
+		"h/pub/a.md":              "---\ndate: 2020-01-01\ntitle: A\n---\n",
+		"h/pub/b/c.md":            "---\ndate: 2022-01-01\ntitle: C\n---\n",
+		"h/pub/d.md":              "---\ndate: 2023-01-01\ntitle: D\ndraft: true\n---\n",
+		"h/pub/e.md":              "---\ndate: 2021-01-01\ntitle: E\nexpires: 2000-01-01\n---\n",
+		"h/pub/undated.md":        "undated",
+	})
+	setFlag(t, recentCount, 5)
+	body := getPage("/undated").Body.String()
+	if want := "<f>[C|/b/c][A|/a]</f>"; !strings.HasSuffix(body, want) {
+		t.Errorf("got %q, want it to end %q", body, want)
+	}
+}
+
+// A herd of requests missing the caches at once share one walk and one parse
+func TestConcurrentMissesLoadOnce(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/footer.html": "<f>{{range .Recent}}[{{.Title}}]{{end}}</f>",
+		"h/pub/a.md":              "---\ndate: 2020-01-01\n---\na",
+	})
+	setFlag(t, recentCount, 5)
+	var mu sync.Mutex
+	walks := 0
+	load := loadSite
+	loadSite = func(root string) siteCache {
+		mu.Lock()
+		walks++
+		mu.Unlock()
+		// hold the walk open so every request misses while it runs
+		time.Sleep(50 * time.Millisecond)
+		return load(root)
+	}
+	t.Cleanup(func() { loadSite = load })
+	reads := countTemplateReads(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := getPage("/a"); !strings.HasSuffix(w.Body.String(), "<f>[A]</f>") {
+				t.Errorf("got status %d: %q", w.Code, w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	if walks != 1 {
+		t.Errorf("site walked %d times, want 1", walks)
+	}
+	for _, name := range []string{"h/templates/header.html", "h/templates/view.html", "h/templates/footer.html"} {
+		if n := reads(name); n != 1 {
+			t.Errorf("%s read %d times, want 1", name, n)
+		}
+	}
+}
+
+func TestFeatured(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/footer.html": "<f>{{range .Featured}}[{{.Title}}|{{.Path}}]{{end}}</f>",
+		"h/pub/a.md":              "---\ntitle: Old\ndate: 2024-01-01\nfeatured: true\n---\na",
+		"h/pub/d/b.md":            "---\ntitle: New\ndate: 2024-03-01\nfeatured: true\n---\nb",
+		"h/pub/c.md":              "---\ntitle: Plain\ndate: 2024-02-01\n---\nc",
+		"h/pub/e.md":              "---\ntitle: Draft\ndate: 2024-04-01\nfeatured: true\ndraft: true\n---\ne",
+		"h/pub/f.md":              "---\ntitle: Hidden\ndate: 2024-05-01\nfeatured: true\nhidden: true\n---\nf",
+	})
+	want := "<f>[New|/d/b][Old|/a]</f>"
+	if body := getPage("/c").Body.String(); !strings.HasSuffix(body, want) {
+		t.Errorf("got %q, want it to end %q", body, want)
+	}
+}
+
+func TestSiteWalkOnlyWhenUsed(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md": "---\ndate: 2024-01-01\n---\na",
+		"h/pub/b.md": "---\npermalink: /short\n---\nb",
+	})
+	walked := func() bool {
+		sites.Lock()
+		defer sites.Unlock()
+		return len(sites.m) > 0
+	}
+	if w := getPage("/a"); w.Code != http.StatusOK || walked() {
+		t.Errorf("page without Recent or Featured got status %d, walked %v", w.Code, walked())
+	}
+	if w := getPage("/short"); w.Code != http.StatusOK || !walked() {
+		t.Errorf("permalink got status %d, walked %v", w.Code, walked())
+	}
+	newSite(t, map[string]string{
+		"h/templates/footer.html": "<f>{{range .Recent}}{{.Title}}{{end}}</f>",
+		"h/pub/a.md":              "---\ntitle: A\ndate: 2024-01-01\n---\na",
+	})
+	if body := getPage("/a").Body.String(); !strings.HasSuffix(body, "<f>A</f>") {
+		t.Errorf("template using Recent got %q", body)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Robots directives we know of, ones with a colon take a value
+var robotsDirectives = map[string]bool{
+	"all": true, "index": true, "follow": true, "noindex": true, "nofollow": true,
+	"none": true, "noarchive": true, "nocache": true, "nosnippet": true,
+	"noimageindex": true, "notranslate": true, "indexifembedded": true,
+	"max-snippet": true, "max-image-preview": true, "max-video-preview": true,
+	"unavailable_after": true,
+}
+
+// Split a robots front matter string into lowercase directives
+func robotsTokens(robots string) []string {
+	var tokens []string
+	for _, t := range strings.Split(robots, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); len(t) > 0 {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// Find any robots directives search engines won't understand
+func unknownRobots(robots string) []string {
+	var unknown []string
+	for _, t := range robotsTokens(robots) {
+		name, _, _ := strings.Cut(t, ":")
+		if !robotsDirectives[strings.TrimSpace(name)] {
+			unknown = append(unknown, t)
+		}
+	}
+	return unknown
+}
+
+// Whether a page asks search engines to leave it out
+func noindex(info PageInfo) bool {
+	for _, t := range robotsTokens(info.Robots) {
+		if t == "noindex" || t == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// How often a sitemap can say a page changes
+var changefreqs = map[string]bool{
+	"always": true, "hourly": true, "daily": true, "weekly": true,
+	"monthly": true, "yearly": true, "never": true,
+}
+
+// Get a page's sitemap_priority front matter, which must be from 0 to 1
+func sitemapPriority(f map[string]interface{}) (float64, error) {
+	var p float64
+	switch v := f["sitemap_priority"].(type) {
+	case float64:
+		p = v
+	case int:
+		p = float64(v)
+	default:
+		return 0, errors.New("no sitemap_priority")
+	}
+	if p < 0 || p > 1 {
+		return 0, fmt.Errorf("sitemap_priority %v isn't from 0 to 1", p)
+	}
+	return p, nil
+}
+
+// Get a page's sitemap_changefreq front matter, which must be one the
+// sitemap protocol knows
+func sitemapChangefreq(f map[string]interface{}) (string, error) {
+	c, ok := f["sitemap_changefreq"].(string)
+	if !ok {
+		return "", errors.New("no sitemap_changefreq")
+	}
+	c = strings.ToLower(strings.TrimSpace(c))
+	if !changefreqs[c] {
+		return "", fmt.Errorf("unknown sitemap_changefreq %q", c)
+	}
+	return c, nil
+}
+
+type urlset struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+var sitemapShard = regexp.MustCompile(`^/sitemap-([0-9]+)\.xml$`)
+
+// Get the site's listed pages for its sitemap, leaving out noindex ones
+// Pages without sitemap front matter leave search engines to their defaults
+func sitemapURLs(r *http.Request) []sitemapURL {
+	var urls []sitemapURL
+	for _, p := range sitePages(r) {
+		if !listed(p.Info) || noindex(p.Info) {
+			continue
+		}
+		urls = append(urls, sitemapURL{
+			Loc:        absURL(r, p.URL),
+			LastMod:    p.Date.Format("2006-01-02"),
+			ChangeFreq: p.Info.SitemapChangefreq,
+			Priority:   p.Info.SitemapPriority,
+		})
+	}
+	return urls
+}
+
+// Check whether a request is for one of the sitemap URLs
+func isSitemap(path string) bool {
+	return path == "/sitemap.xml" || path == "/sitemap_index.xml" || sitemapShard.MatchString(path)
+}
+
+// Serve the site's sitemap
+// Sites with more than -sitemapSize pages are split into /sitemap-N.xml
+// shards listed by /sitemap_index.xml, which /sitemap.xml then serves too
+func sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	urls := sitemapURLs(r)
+	size := *sitemapSize
+	if size <= 0 {
+		size = len(urls) + 1
+	}
+	shards := (len(urls) + size - 1) / size
+	var doc interface{}
+	switch m := sitemapShard.FindStringSubmatch(r.URL.Path); {
+	case m != nil:
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 || n > shards {
+			renderError(w, r, http.StatusNotFound, "No such sitemap: "+r.URL.Path)
+			return
+		}
+		end := n * size
+		if end > len(urls) {
+			end = len(urls)
+		}
+		doc = urlset{URLs: urls[(n-1)*size : end]}
+	case r.URL.Path == "/sitemap_index.xml" || len(urls) > size:
+		index := sitemapIndex{}
+		for n := 1; n <= shards; n++ {
+			index.Sitemaps = append(index.Sitemaps, sitemapURL{Loc: absURL(r, fmt.Sprintf("/sitemap-%d.xml", n))})
+		}
+		doc = index
+	default:
+		doc = urlset{URLs: urls}
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Could not build sitemap.")
+		logRequest(r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+}
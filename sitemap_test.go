@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRobots(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/view.html": "<v>[{{.Robots}}]</v>",
+		"h/pub/a.md":            "---\nrobots: noindex, nofollow\n---\na",
+		"h/pub/b.md":            "---\nrobots: nofollow, bogus\n---\nb",
+	})
+	logged := captureLog(t)
+	if body := getPage("/a").Body.String(); !strings.Contains(body, "<v>[noindex, nofollow]</v>") {
+		t.Errorf("got %q", body)
+	}
+	setFlag(t, strictFrontMatter, true)
+	// a loose check, so the page is still served
+	if w := getPage("/b"); w.Code != http.StatusOK || !strings.Contains(logged.String(), `unknown robots directive "bogus"`) {
+		t.Errorf("got status %d, logged %s", w.Code, logged)
+	}
+	sitemap := getPage("/sitemap.xml").Body.String()
+	if strings.Contains(sitemap, "http://h/a<") || !strings.Contains(sitemap, "http://h/b<") {
+		t.Errorf("sitemap has %s", sitemap)
+	}
+}
+
+func TestRobotsTokens(t *testing.T) {
+	if got := strings.Join(robotsTokens(" NoIndex ,nofollow,, "), "|"); got != "noindex|nofollow" {
+		t.Errorf("got %s", got)
+	}
+	if got := unknownRobots("noindex, bogus, max-snippet:20"); len(got) != 1 || got[0] != "bogus" {
+		t.Errorf("got unknown %q", got)
+	}
+}
+
+func TestSitemapIndex(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 25; i++ {
+		files[fmt.Sprintf("h/pub/d%d/p%02d.md", i%3, i)] = "x"
+	}
+	newSite(t, files)
+	if body := getPage("/sitemap.xml").Body.String(); strings.Count(body, "<url>") != 25 {
+		t.Errorf("small sitemap got %d URLs", strings.Count(body, "<url>"))
+	}
+	setFlag(t, sitemapSize, 10)
+	for _, target := range []string{"/sitemap.xml", "/sitemap_index.xml"} {
+		body := getPage(target).Body.String()
+		if strings.Count(body, "<sitemap>") != 3 || !strings.Contains(body, "<loc>http://h/sitemap-3.xml</loc>") {
+			t.Errorf("%s got %q", target, body)
+		}
+	}
+	for target, urls := range map[string]int{"/sitemap-1.xml": 10, "/sitemap-2.xml": 10, "/sitemap-3.xml": 5} {
+		if w := getPage(target); w.Code != http.StatusOK || strings.Count(w.Body.String(), "<url>") != urls {
+			t.Errorf("%s got %d with %d URLs, want %d", target, w.Code, strings.Count(w.Body.String(), "<url>"), urls)
+		}
+	}
+	captureLog(t)
+	for _, target := range []string{"/sitemap-0.xml", "/sitemap-4.xml"} {
+		if w := getPage(target); w.Code != http.StatusNotFound {
+			t.Errorf("%s got %d", target, w.Code)
+		}
+	}
+}
+
+func TestSitemapFrontMatter(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md": "---\nsitemap_priority: 0.8\nsitemap_changefreq: Weekly\n---\na",
+		"h/pub/b.md": "---\nsitemap_priority: 1\n---\nb",
+		"h/pub/c.md": "---\nsitemap_priority: 3\nsitemap_changefreq: often\n---\nc",
+	})
+	body := getPage("/sitemap.xml").Body.String()
+	for _, want := range []string{
+		"<loc>http://h/a</loc>\n    <lastmod>",
+		"<changefreq>weekly</changefreq>\n    <priority>0.8</priority>",
+		"<loc>http://h/b</loc>\n    <lastmod>",
+		"<priority>1</priority>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("sitemap missing %q: %s", want, body)
+		}
+	}
+	// c's values are out of range, so it gets the defaults
+	if strings.Count(body, "<priority>") != 2 || strings.Count(body, "<changefreq>") != 1 {
+		t.Errorf("got %s", body)
+	}
+	for _, c := range []struct {
+		f  map[string]interface{}
+		ok bool
+	}{
+		{map[string]interface{}{"sitemap_priority": 1.5}, false},
+		{map[string]interface{}{"sitemap_priority": -1}, false},
+		{map[string]interface{}{"sitemap_changefreq": "often"}, false},
+		{map[string]interface{}{"sitemap_priority": 0, "sitemap_changefreq": "never"}, true},
+	} {
+		if _, err := validateFrontMatter(c.f); (err == nil) != c.ok {
+			t.Errorf("%v got %v", c.f, err)
+		}
+	}
+}
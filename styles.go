@@ -0,0 +1,32 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// Build links for the stylesheets asked for with ?css=, so designers can
+// try out styles without touching the templates
+// Returns false if any of them isn't in -allowedStyles
+func previewStyles(r *http.Request) ([]byte, bool) {
+	requested := r.URL.Query()["css"]
+	if len(requested) == 0 {
+		return nil, true
+	}
+	allowed := make(map[string]bool)
+	for _, s := range strings.Split(*allowedStyles, ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			allowed[s] = true
+		}
+	}
+	var links []byte
+	for _, css := range requested {
+		if !allowed[css] {
+			logRequest(r, "Refusing stylesheet", css)
+			return nil, false
+		}
+		links = append(links, `<link rel="stylesheet" href="`+template.HTMLEscapeString(css)+`">`+"\n"...)
+	}
+	return links, true
+}
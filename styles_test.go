@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPreviewStyles(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/header.html": "<html><head><title>t</title></head><body>",
+		"h/pub/a.md":              "a",
+	})
+	setFlag(t, allowedStyles, "/assets/experimental.css, dark.css")
+	w := getPage("/a?css=/assets/experimental.css")
+	if want := "<link rel=\"stylesheet\" href=\"/assets/experimental.css\">\n</head>"; w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+		t.Errorf("got status %d: %q, want it to contain %q", w.Code, w.Body.String(), want)
+	}
+	if w := getPage("/a?css=evil.css"); w.Code != http.StatusBadRequest || strings.Contains(w.Body.String(), "evil.css") {
+		t.Errorf("disallowed stylesheet got status %d: %q", w.Code, w.Body.String())
+	}
+	if body := getPage("/a").Body.String(); strings.Contains(body, "stylesheet") {
+		t.Errorf("stylesheet injected without ?css=: %q", body)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Find pages in the same directory whose names are close to a missing one
+// At most -suggestions are returned, closest first
+func suggestPages(r *http.Request) []Link {
+	if *suggestions <= 0 {
+		return nil
+	}
+	dir := path.Dir(strings.TrimSuffix(r.URL.Path, "/"))
+	pubDir := filepath.Join(getPubRoot(r), dir)
+	if _, st, err := resolvePath(pubDir); err != nil || !st.IsDir() {
+		return nil
+	}
+	links, err := loadDir(r, pubDir)
+	if err != nil {
+		return nil
+	}
+	want := strings.ToLower(trimPageExt(path.Base(r.URL.Path)))
+	// anything further off than a third of the name isn't a near miss
+	limit := len(want)/3 + 1
+	type candidate struct {
+		link Link
+		dist int
+	}
+	var near []candidate
+	for _, l := range links {
+		name := strings.ToLower(path.Base(strings.TrimSuffix(l.Path, "/")))
+		if d := levenshtein(want, name); d <= limit {
+			near = append(near, candidate{l, d})
+		}
+	}
+	sort.SliceStable(near, func(i, j int) bool {
+		return near[i].dist < near[j].dist
+	})
+	var found []Link
+	for i := 0; i < len(near) && i < *suggestions; i++ {
+		found = append(found, near[i].link)
+	}
+	return found
+}
+
+// Count the single character edits turning a into b
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
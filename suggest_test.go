@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSuggestions(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/404.html":    "{{range .Suggestions}}[{{.Title}}|{{.Path}}]{{end}}",
+		"h/pub/docs/install.md":   "i",
+		"h/pub/docs/usage.md":     "u",
+		"h/pub/docs/unrelated.md": "x",
+	})
+	for target, want := range map[string]string{
+		"/docs/instll":  "[Install|/docs/install]",
+		"/docs/usge/":   "[Usage|/docs/usage]",
+		"/docs/zzzzzzz": "",
+		"/nodir/x":      "",
+	} {
+		w := getPage(target)
+		if w.Code != http.StatusNotFound || w.Body.String() != want {
+			t.Errorf("%s got status %d: %q, want %q", target, w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"install", "instll", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"same", "same", 0},
+	} {
+		if got := levenshtein(c.a, c.b); got != c.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
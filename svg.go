@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var altAttr = regexp.MustCompile(`alt="([^"]*)"`)
+
+// Replace <img> tags pointing at local SVGs with the SVG itself
+// root is the public directory, dir is the directory of the page being rendered
+// SVGs that can't be read or parsed are left as images
+func inlineSVGs(root, dir string, page []byte) []byte {
+	return imgTag.ReplaceAllFunc(page, func(tag []byte) []byte {
+		m := srcAttr.FindSubmatch(tag)
+		if m == nil {
+			return tag
+		}
+		filename, ok := localFile(root, dir, string(m[1]))
+		if !ok || strings.ToLower(filepath.Ext(filename)) != ".svg" {
+			return tag
+		}
+		filename, st, err := resolvePath(filename)
+		if err != nil || st.IsDir() {
+			return tag
+		}
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			return tag
+		}
+		var alt string
+		if a := altAttr.FindSubmatch(tag); a != nil {
+			alt = html.UnescapeString(string(a[1]))
+		}
+		svg, ok := sanitizeSVG(contents, alt)
+		if !ok {
+			return tag
+		}
+		return svg
+	})
+}
+
+// Strip anything that could run script from an SVG document
+// Only known SVG elements are kept, without event handlers or unsafe links
+func sanitizeSVG(contents []byte, label string) ([]byte, bool) {
+	if !wellFormed(contents) {
+		return nil, false
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(bytes.NewReader(contents), body)
+	if err != nil {
+		return nil, false
+	}
+	var svg *html.Node
+	for _, n := range nodes {
+		if n.Type == html.ElementNode && n.Data == "svg" {
+			svg = n
+			break
+		}
+	}
+	if svg == nil {
+		return nil, false
+	}
+	cleanSVG(svg)
+	if len(label) > 0 {
+		svg.Attr = append(svg.Attr,
+			html.Attribute{Key: "role", Val: "img"},
+			html.Attribute{Key: "aria-label", Val: label})
+	}
+	var out bytes.Buffer
+	if err := html.Render(&out, svg); err != nil {
+		return nil, false
+	}
+	return out.Bytes(), true
+}
+
+// The SVG elements kept when an SVG is inlined, lowercased
+// Anything else goes along with all it holds, which takes out scripts,
+// foreignObject, style sheets and the animations that can rewrite links
+var svgElements = map[string]bool{
+	"a": true, "circle": true, "clippath": true, "defs": true, "desc": true,
+	"ellipse": true, "feblend": true, "fecolormatrix": true, "fecomposite": true,
+	"fedropshadow": true, "feflood": true, "fegaussianblur": true, "femerge": true,
+	"femergenode": true, "femorphology": true, "feoffset": true, "filter": true,
+	"g": true, "image": true, "line": true, "lineargradient": true, "marker": true,
+	"mask": true, "path": true, "pattern": true, "polygon": true, "polyline": true,
+	"radialgradient": true, "rect": true, "stop": true, "svg": true, "symbol": true,
+	"text": true, "textpath": true, "title": true, "tspan": true, "use": true,
+}
+
+// Strip event handlers and unsafe links from n and the elements below it,
+// and drop any element not in svgElements
+func cleanSVG(n *html.Node) {
+	var attrs []html.Attribute
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if strings.HasPrefix(key, "on") {
+			continue
+		}
+		if (key == "href" || strings.HasSuffix(key, ":href") || key == "src") && !safeSVGURL(a.Val) {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			if svgElements[strings.ToLower(c.Data)] {
+				cleanSVG(c)
+			} else {
+				n.RemoveChild(c)
+			}
+		}
+		c = next
+	}
+}
+
+// Check a link in an SVG only goes to a fragment, a relative URL or http(s)
+// Browsers ignore whitespace and control characters in a scheme, so they're
+// dropped before looking at it
+func safeSVGURL(u string) bool {
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+	end := strings.IndexAny(u, ":/?#")
+	if end < 0 || u[end] != ':' {
+		return true
+	}
+	switch strings.ToLower(u[:end]) {
+	case "http", "https":
+		return true
+	}
+	return false
+}
+
+// Check an SVG parses as XML, since the HTML parser accepts anything
+func wellFormed(contents []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(contents))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineSVG(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":       "![Logo](good.svg) ![bad](bad.svg) ![broken](broken.svg)",
+		"h/pub/good.svg":   `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><circle cx="5" cy="5" r="4"/></svg>`,
+		"h/pub/bad.svg":    `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" onload="alert(1)"><script>alert(2)</script><a xlink:href="javascript:alert(3)"><rect width="1" height="1" onclick="x()"/></a><foreignObject><body/></foreignObject></svg>`,
+		"h/pub/broken.svg": `<svg><g></svg>`,
+	})
+	setFlag(t, inlineSVG, true)
+	body := getPage("/a").Body.String()
+	if !strings.Contains(body, `<circle cx="5" cy="5" r="4">`) || !strings.Contains(body, `aria-label="Logo"`) {
+		t.Errorf("benign SVG not inlined: %s", body)
+	}
+	for _, bad := range []string{"alert", "onclick", "foreignObject", "<body"} {
+		if strings.Contains(body, bad) {
+			t.Errorf("%s left in: %s", bad, body)
+		}
+	}
+	if !strings.Contains(body, `src="broken.svg" alt="broken"`) {
+		t.Errorf("malformed SVG not left as an image: %s", body)
+	}
+}
+
+func TestSanitizeSVG(t *testing.T) {
+	for _, svg := range []string{
+		`<svg><a href=" java&#x09;script:alert(1)"><text>x</text></a></svg>`,
+		`<svg><a href="JaVaScRiPt:alert(1)"><text>x</text></a></svg>`,
+		`<svg><image href="data:image/svg+xml;base64,PHN2Zz48L3N2Zz4="/></svg>`,
+		`<svg><a href="#x"><set attributeName="href" to="javascript:alert(1)"/></a></svg>`,
+		`<svg><a href="#x"><animate attributeName="href" values="javascript:alert(1)"/></a></svg>`,
+		`<svg><style>@import "javascript:alert(1)";</style></svg>`,
+	} {
+		out, ok := sanitizeSVG([]byte(svg), "")
+		if !ok {
+			t.Errorf("%s didn't sanitize", svg)
+			continue
+		}
+		lower := strings.ToLower(string(out))
+		for _, bad := range []string{"script", "data:", "<set", "<animate", "<style"} {
+			if strings.Contains(lower, bad) {
+				t.Errorf("%s came out as %s", svg, out)
+			}
+		}
+	}
+	for u, want := range map[string]bool{
+		"#frag":               true,
+		"other.svg#frag":      true,
+		"/img/x.png":          true,
+		"https://example.com": true,
+		"HTTP://example.com":  true,
+		"javascript:alert(1)": false,
+		"\tjavascript:x":      false,
+		"\x01javascript:x":    false,
+		"data:text/html,x":    false,
+		"vbscript:x":          false,
+	} {
+		if got := safeSVGURL(u); got != want {
+			t.Errorf("safeSVGURL(%q) = %v, want %v", u, got, want)
+		}
+	}
+}
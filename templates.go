@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path/filepath"
+)
+
+// Parse every template of every host, themes included
+// Returns a description of each template that won't parse
+func validateTemplates() []string {
+	var problems []string
+	for _, host := range listHosts() {
+		walkRoots(filepath.Join(host, "templates"), func(path string, d fs.DirEntry) error {
+			if d.IsDir() || filepath.Ext(path) != ".html" {
+				return nil
+			}
+			filename, _, err := resolvePath(path)
+			if err == nil {
+				_, err = template.ParseFiles(filename)
+			}
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+			}
+			return nil
+		})
+	}
+	return problems
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Count the template files read from now on
+func countTemplateReads(t *testing.T) func(name string) int {
+	var mu sync.Mutex
+	reads := make(map[string]int)
+	read := readTemplate
+	readTemplate = func(name string) ([]byte, error) {
+		mu.Lock()
+		reads[name]++
+		mu.Unlock()
+		return read(name)
+	}
+	t.Cleanup(func() { readTemplate = read })
+	return func(name string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return reads[name]
+	}
+}
+
+func TestChangedTemplateReloadsAlone(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a"})
+	setFlag(t, cacheTimeout, time.Hour)
+	reads := countTemplateReads(t)
+	getPage("/a")
+	if err := os.WriteFile("h/templates/header.html", []byte("<new>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes("h/templates/header.html", later, later)
+	body := getPage("/a").Body.String()
+	if body[:5] != "<new>" {
+		t.Errorf("changed header not used: %q", body)
+	}
+	if n := reads("h/templates/header.html"); n != 2 {
+		t.Errorf("header read %d times, want 2", n)
+	}
+	for _, name := range []string{"h/templates/view.html", "h/templates/footer.html"} {
+		if n := reads(name); n != 1 {
+			t.Errorf("%s read %d times, want 1", name, n)
+		}
+	}
+}
+
+func TestTheme(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":                   "a",
+		"h/templates/dark/header.html": "<dark>",
+		"h/templates/dark/view.html":   "{{.Page}}",
+		"h/templates/dark/footer.html": "</dark>",
+	})
+	for target, prefix := range map[string]string{
+		"/a":               "<h></h><v>",
+		"/a?theme=dark":    "<dark><p>a</p>",
+		"/a?theme=../../x": "<h></h><v>",
+		"/a?theme=missing": "<h></h><v>",
+	} {
+		if body := getPage(target).Body.String(); !strings.HasPrefix(body, prefix) {
+			t.Errorf("%s got %q, want it to start %q", target, body, prefix)
+		}
+	}
+	setFlag(t, theme, "dark")
+	if body := getPage("/a").Body.String(); !strings.HasPrefix(body, "<dark>") {
+		t.Errorf("-theme=dark got %q", body)
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	newSite(t, map[string]string{"h/templates/dark/view.html": "{{if}}"})
+	problems := validateTemplates()
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], filepath.Join("h", "templates", "dark", "view.html")+":") {
+		t.Errorf("got %q", problems)
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a"})
+	setFlag(t, cacheTimeout, time.Hour)
+	setFlag(t, noCache, true)
+	// the same modification time, so only skipping the cache notices the change
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes("h/templates/footer.html", old, old)
+	getPage("/a")
+	if err := os.WriteFile("h/templates/footer.html", []byte("<new>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes("h/templates/footer.html", old, old)
+	if body := getPage("/a").Body.String(); !strings.HasSuffix(body, "<new>") {
+		t.Errorf("changed footer not used: %q", body)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/wide.html": "<wide>{{.Page}}</wide>",
+		"secret.html":           "<secret>",
+		"h/pub/a.md":            "---\nlayout: wide\n---\na",
+		"h/pub/b.md":            "---\nlayout: ../../secret\n---\nb",
+		"h/pub/c.md":            "---\nlayout: missing\n---\nc",
+	})
+	logged := captureLog(t)
+	for target, want := range map[string]string{
+		"/a": "<h></h><wide><p>a</p>\n</wide><f></f>",
+		"/b": "<h></h><v><p>b</p>\n</v><f></f>",
+		"/c": "<h></h><v><p>c</p>\n</v><f></f>",
+	} {
+		if body := getPage(target).Body.String(); body != want {
+			t.Errorf("%s got %q, want %q", target, body, want)
+		}
+	}
+	if !strings.Contains(logged.String(), "../../secret") {
+		t.Errorf("traversal not logged: %s", logged)
+	}
+}
+
+// Run with -race to check the template cache is safe to fill concurrently
+func TestConcurrentUncachedTemplate(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a"})
+	var wg sync.WaitGroup
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = getPage("/a").Code
+		}()
+	}
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d got status %d", i, code)
+		}
+	}
+}
+
+func TestBuiltinTheme(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":   "---\ntitle: Hi\n---\nhello",
+		"h/pub/d/b.md": "b",
+	})
+	if err := os.RemoveAll("h/templates"); err != nil {
+		t.Fatal(err)
+	}
+	if w := getPage("/a"); w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "hello") {
+		t.Errorf("without -defaultTheme got status %d: %q", w.Code, w.Body.String())
+	}
+	setFlag(t, defaultTheme, true)
+	body := getPage("/a").Body.String()
+	if !strings.HasPrefix(body, "<!DOCTYPE html>") || !strings.Contains(body, "<title>Hi</title>") || !strings.Contains(body, "<p>hello</p>") {
+		t.Errorf("page got %q", body)
+	}
+	if body := getPage("/d/").Body.String(); !strings.Contains(body, `<li><a href="/d/b">B</a></li>`) {
+		t.Errorf("listing got %q", body)
+	}
+	setFlag(t, defaultTheme, false)
+	if body := getPage("/a").Body.String(); strings.Contains(body, "hello") || !strings.Contains(body, "doesn't know how to serve") {
+		t.Errorf("-defaultTheme=false got %q", body)
+	}
+}
+
+// Templates come from the page's directory, then the theme, then the host,
+// then the built-in theme
+func TestTemplateChain(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/header.html":          "<host-h>",
+		"h/templates/view.html":            "<host-v>",
+		"h/templates/dark/view.html":       "<dark-v>",
+		"h/templates/dirs/d/view.html":     "<d-v>",
+		"h/templates/dirs/d/e/footer.html": "<de-f>",
+		"h/pub/a.md":                       "a",
+		"h/pub/d/b.md":                     "b",
+		"h/pub/d/e/c.md":                   "c",
+	})
+	if err := os.Remove("h/templates/footer.html"); err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, defaultTheme, true)
+	builtin := "</main>\n<footer>"
+	for target, want := range map[string]string{
+		"/a":              "<host-h><host-v>" + builtin,
+		"/a?theme=dark":   "<host-h><dark-v>" + builtin,
+		"/d/b":            "<host-h><d-v>" + builtin,
+		"/d/b?theme=dark": "<host-h><d-v>" + builtin,
+		"/d/e/c":          "<host-h><d-v><de-f>",
+	} {
+		if body := getPage(target).Body.String(); !strings.HasPrefix(body, want) {
+			t.Errorf("%s got %q, want it to start %q", target, body, want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+)
+
+//go:embed theme/*.html
+var themeFiles embed.FS
+
+// The built in templates used by sites that lack one, see -defaultTheme
+var defaultTemplates = template.Must(template.ParseFS(themeFiles, "theme/*.html"))
+
+// Get the built in template named tmpl, if there is one and -defaultTheme allows it
+func defaultTemplate(tmpl string) (*template.Template, bool) {
+	if !*defaultTheme {
+		return nil, false
+	}
+	t := defaultTemplates.Lookup(tmpl + ".html")
+	return t, t != nil
+}
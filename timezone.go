@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Time zones already loaded, by name
+var locations = struct {
+	sync.Mutex
+	m map[string]*time.Location
+}{m: make(map[string]*time.Location)}
+
+// Load a time zone by name, remembering it for next time
+func loadLocation(name string) (*time.Location, error) {
+	locations.Lock()
+	defer locations.Unlock()
+	if loc, ok := locations.m[name]; ok {
+		return loc, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.m[name] = loc
+	return loc, nil
+}
+
+// Get the time zone a host's dates are in, from its wurk.yaml or -timezone
+// A zone that won't load is logged and UTC used instead
+func siteLocation(r *http.Request, host string) *time.Location {
+	name := loadHostConfig(host).Timezone
+	if len(name) == 0 {
+		name = *timezone
+	}
+	loc, err := loadLocation(name)
+	if err != nil {
+		logRequest(r, host+":", err)
+		return time.UTC
+	}
+	return loc
+}
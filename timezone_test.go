@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTimezone(t *testing.T) {
+	f, _, err := parseFrontMatter([]byte("---\ntime: 2024-01-02T23:30:00Z\n---\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for zone, want := range map[string]string{
+		"UTC":        "2024-01-02 23:30",
+		"Asia/Tokyo": "2024-01-03 08:30",
+	} {
+		loc, err := loadLocation(zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pi := NewPageInfo(nil, f, loc); pi.Date+" "+pi.Time != want {
+			t.Errorf("%s got %s %s, want %s", zone, pi.Date, pi.Time, want)
+		}
+	}
+	if _, err := loadLocation("Nowhere/Special"); err == nil {
+		t.Error("unknown zone loaded")
+	}
+
+	newSite(t, map[string]string{
+		"h/pub/a.md":            "---\ntime: 2024-01-02T23:30:00Z\n---\na",
+		"h/templates/view.html": "{{.Date}} {{.Time}}",
+		"h/wurk.yaml":           "timezone: Asia/Tokyo\n",
+	})
+	setFlag(t, timezone, "UTC")
+	if body := getPage("/a").Body.String(); !strings.Contains(body, "2024-01-03 08:30") {
+		t.Errorf("host timezone not used: %q", body)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"html/template"
+	"regexp"
+	"strconv"
+)
+
+// A heading in a page's table of contents
+type TOCEntry struct {
+	Level int
+	ID    string
+	Title string
+}
+
+var headingTag = regexp.MustCompile(`(?s)<h([1-6]) id="([^"]*)">(.*?)</h[1-6]>`)
+
+// Whether a page gets a table of contents, from -toc or its toc front matter
+func wantTOC(f map[string]interface{}) bool {
+	if t, ok := f["toc"].(bool); ok {
+		return t
+	}
+	return *toc
+}
+
+// How many heading levels a page's table of contents goes down
+func tocDepth(f map[string]interface{}) int {
+	if d, ok := f["toc_depth"].(int); ok {
+		return d
+	}
+	return *defaultTOCDepth
+}
+
+// List the headings of a rendered page, going depth levels below the top one
+func tableOfContents(page template.HTML, depth int) []TOCEntry {
+	var entries []TOCEntry
+	top := 7
+	for _, m := range headingTag.FindAllStringSubmatch(string(page), -1) {
+		level, _ := strconv.Atoi(m[1])
+		if level < top {
+			top = level
+		}
+		entries = append(entries, TOCEntry{Level: level, ID: m[2], Title: plainText(m[3])})
+	}
+	var kept []TOCEntry
+	for _, e := range entries {
+		if e.Level < top+depth {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTOCDepth(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/footer.html": "<f>{{range .TOC}}[{{.Level}}|{{.ID}}|{{.Title}}]{{end}}</f>",
+		"h/pub/a.md":              "---\ntoc: true\ntoc_depth: 2\n---\n# One\n## Two\n### Three\n#### Four\n# Again\n",
+	})
+	body := getPage("/a").Body.String()
+	if want := "<f>[1|one|One][2|two|Two][1|again|Again]</f>"; !strings.HasSuffix(body, want) {
+		t.Errorf("got %q, want it to end %q", body, want)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"github.com/HugoSmits86/nativewebp"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebP versions of images, kept until the image changes
+// A nil webp means the conversion came out no smaller than the original
+type webpCache struct {
+	webp []byte
+	mod  time.Time
+}
+
+var webps = struct {
+	sync.Mutex
+	m map[string]webpCache
+}{m: make(map[string]webpCache)}
+
+// Serve a JPEG or PNG as WebP to clients that accept it, when that's smaller
+// Returns false if the original should be served instead
+func serveWebP(w http.ResponseWriter, r *http.Request, filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png":
+	default:
+		return false
+	}
+	w.Header().Add("Vary", "Accept")
+	if !headerAccepts(r.Header.Get("Accept"), "image/webp") {
+		return false
+	}
+	st, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+	webps.Lock()
+	wc, ok := webps.m[filename]
+	webps.Unlock()
+	if *noCache || !ok || !wc.mod.Equal(st.ModTime()) {
+		// -cacheDir keeps conversions across restarts, an empty entry
+		// records one that wasn't worth it
+		key := cacheKey("webp", filename, st.ModTime().String())
+		out, ok := cacheGet(key)
+		if !ok {
+			out, err = convertWebP(filename)
+			if err != nil {
+				logRequest(r, "Couldn't convert", filename, err)
+				return false
+			}
+			if int64(len(out)) >= st.Size() {
+				out = nil
+			}
+			cachePut(r, key, out)
+		}
+		if len(out) == 0 {
+			out = nil
+		}
+		wc = webpCache{webp: out, mod: st.ModTime()}
+		webps.Lock()
+		webps.m[filename] = wc
+		webps.Unlock()
+	}
+	if wc.webp == nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "image/webp")
+	w.Header().Set("Content-Length", strconv.Itoa(len(wc.webp)))
+	if r.Method != http.MethodHead {
+		w.Write(wc.webp)
+	}
+	return true
+}
+
+// Re-encode an image file as lossless WebP
+func convertWebP(filename string) ([]byte, error) {
+	img, _, err := decodeImage(filename)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
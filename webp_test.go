@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/HugoSmits86/nativewebp"
+	"image/png"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestWebP(t *testing.T) {
+	pic := testImage(t, "png", 200, 100)
+	newSite(t, map[string]string{"h/pub/a.png": pic})
+	setFlag(t, webpImages, true)
+	h := http.HandlerFunc(pageHandler)
+	w := request(h, http.MethodGet, "/a.png", map[string]string{"Accept": "image/avif,image/webp,*/*"})
+	if w.Header().Get("Content-Type") != "image/webp" || w.Body.Len() >= len(pic) {
+		t.Fatalf("got %s of %d bytes", w.Header().Get("Content-Type"), w.Body.Len())
+	}
+	img, err := nativewebp.Decode(w.Body)
+	if err != nil || img.Bounds().Dx() != 200 || img.Bounds().Dy() != 100 {
+		t.Errorf("WebP doesn't decode to the image: %v", err)
+	}
+	if !slices.Contains(w.Header().Values("Vary"), "Accept") {
+		t.Errorf("got Vary %q", w.Header().Values("Vary"))
+	}
+	w = request(h, http.MethodGet, "/a.png", map[string]string{"Accept": "image/png"})
+	if _, err := png.Decode(w.Body); err != nil || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("without image/webp got %s: %v", w.Header().Get("Content-Type"), err)
+	}
+	w = request(h, http.MethodGet, "/a.png", map[string]string{"Accept": "image/webp;q=0, image/png"})
+	if _, err := png.Decode(w.Body); err != nil || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("with image/webp;q=0 got %s: %v", w.Header().Get("Content-Type"), err)
+	}
+}
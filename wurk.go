@@ -2,48 +2,126 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
-	"github.com/gernest/front"
 	"github.com/russross/blackfriday/v2"
+	"golang.org/x/net/websocket"
+	"golang.org/x/sync/singleflight"
 	"html/template"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	urlpath "path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+var themeName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+var className = regexp.MustCompile(`^[A-Za-z_-][A-Za-z0-9_-]*$`)
+
 const (
-	domainError = `Sorry, this server doesn't know how to serve {{.}}!`
+	domainError = `<p>Sorry, this server doesn't know how to serve {{.Host}}{{.Path}}!</p>
+{{if .Hosts}}<p>It does serve:</p>
+<ul>{{range .Hosts}}<li>{{.}}</li>{{end}}</ul>{{end}}`
 )
 
 // PageInfo tracks any information given to templates
 type PageInfo struct {
-	BreadCrumb []Link
-	Title      string
-	RawDate    time.Time
-	Date       string
-	Time       string
-	Author     string
-	Dir        []Link
-	Page       template.HTML
+	BreadCrumb    []Link
+	Title         string
+	Description   string
+	RawDate       time.Time
+	Date          string
+	Time          string
+	Author        Author
+	Dir           []Link
+	Page          template.HTML
+	Status        int
+	Tags          []string
+	Draft         bool
+	Hidden        bool
+	Pinned        bool
+	IsFeatured    bool
+	Comments      bool
+	Lang          string
+	User          string
+	Authenticated bool
+	Expires       time.Time
+	Image         string
+	Favicon       string
+	PrevPage      string
+	NextPage      string
+	JSONLD        template.JS
+	CrumbJSONLD   template.JS
+	Series        string
+	Weight        int
+	SeriesNav     SeriesNav
+	Gallery       []GalleryImage
+	Permalink     string
+	Suggestions   []Link
+	Recent        []Link
+	Featured      []Link
+	TOC           []TOCEntry
+	Query         map[string]string
+	Thumbnail     string
+	Robots        string
+	Tree          []Link
+	BodyClass     string
+	ExtraCSS      []string
+	ExtraJS       []string
+
+	// sitemap_priority and sitemap_changefreq, when they're valid
+	SitemapPriority   string
+	SitemapChangefreq string
+}
+
+// Who wrote a page, from a plain author name or a map with name, url and avatar
+type Author struct {
+	Name   string
+	URL    string
+	Avatar string
 }
 
 // Cache for template files
 type templateCache struct {
-	t  *template.Template
-	ts time.Time
+	t   *template.Template
+	ts  time.Time
+	mod time.Time
 }
 
-var templates map[string]templateCache
+// Reads template files for parsing, so tests can see which get reread
+var readTemplate = os.ReadFile
+
+// Parsed templates by path, shared between requests
+var templates = struct {
+	sync.RWMutex
+	m map[string]templateCache
+	// concurrent misses for a template share one parse
+	loads singleflight.Group
+}{m: make(map[string]templateCache)}
 
 type Link struct {
-	Title string
-	Path  string
+	Title    string
+	Path     string
+	Date     time.Time
+	Summary  string
+	Author   Author
+	Tags     []string
+	Children []Link
+	Count    int
+	Pinned   bool
 }
 
 // Create a slice of Link for the breadcrumb
@@ -62,79 +140,258 @@ func breadCrumb(path string) []Link {
 		if len(p) == 0 {
 			break
 		}
-		title := strings.ToUpper(p[:1]) + p[1:]
-		title = strings.Replace(title, "_", " ", -1)
-		crumbs = append(crumbs, Link{Title: title, Path: subPath + p})
+		crumbs = append(crumbs, Link{Title: humanize(p), Path: subPath + p})
 		subPath = subPath + p + "/"
 	}
 
 	return crumbs
 }
 
+// Words that read better in capitals
+var acronyms = map[string]bool{
+	"api": true, "css": true, "faq": true, "html": true, "http": true,
+	"id": true, "js": true, "json": true, "rss": true, "sql": true,
+	"ui": true, "url": true, "xml": true,
+}
+
+// Turn a file name like my-api_notes into a title like My API Notes
+func humanize(slug string) string {
+	words := strings.FieldsFunc(slug, func(r rune) bool {
+		return r == '-' || r == '_' || unicode.IsSpace(r)
+	})
+	for i, word := range words {
+		if acronyms[strings.ToLower(word)] {
+			words[i] = strings.ToUpper(word)
+			continue
+		}
+		first, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToTitle(first)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
+
 // Produce a []Link to provide directory listings
+// Each directory listed carries the number of entries in its own listing
 func loadDir(r *http.Request, path string) ([]Link, error) {
+	links, err := listDir(r, path)
+	if err != nil {
+		return nil, err
+	}
+	for i, l := range links {
+		if strings.HasSuffix(l.Path, "/") {
+			links[i].Count = childCount(r, filepath.Join(path, urlpath.Base(l.Path)))
+		}
+	}
+	return links, nil
+}
+
+// List a directory's visible entries
+func listDir(r *http.Request, path string) ([]Link, error) {
 	if len(path) == 0 || path[:1] == "/" {
 		return nil, errors.New("Path not found")
 	}
 
-	files, err := os.ReadDir(path)
+	files, err := readDir(path)
 	if err != nil {
-		log.Println("Couldn't load path ", path)
+		logRequest(r, "Couldn't load path ", path)
 		return nil, err
 	}
 
 	cache := make(map[string]bool)
 	var links []Link
+	patterns := ignorePatterns(getPubRoot(r))
+	blocks := requestBlocks(r)
+	loc := siteLocation(r, siteHost(r))
 	for _, file := range files {
 		f := file.Name()
 		// No hidden files to allow disabling files
-		if f[0] == '.' || f == "_index.md" {
+		if f[0] == '.' || ignored(patterns, getPubRoot(r), filepath.Join(path, f), file.IsDir()) {
+			continue
+		}
+		// nor anything blocked.txt keeps from this client, title and summary included
+		if blocks.covers(getUrl(r, path) + f) {
 			continue
 		}
-		if len(f) > 3 && f[len(f)-3:] == ".md" {
-			f = f[:len(f)-3]
+		var date time.Time
+		if st, err := file.Info(); err == nil {
+			date = st.ModTime()
+		}
+		var title, summary string
+		var pinned bool
+		var author Author
+		var tags []string
+		if !file.IsDir() {
+			f = trimPageExt(f)
+			if f == "_index" {
+				continue
+			}
+			if fm, ok := readFrontMatter(r, filepath.Join(path, f)); ok {
+				info := NewPageInfo(r, fm, loc)
+				if !listed(info) {
+					continue
+				}
+				if hasDate(fm) {
+					date = info.RawDate
+				}
+				pinned = info.Pinned
+				author = info.Author
+				author.Avatar = resolveAsset(r, getUrl(r, path), author.Avatar)
+				tags = info.Tags
+				if *dirSummaries {
+					title = info.Title
+					summary = pageSummary(r, filepath.Join(path, f), fm)
+				}
+			}
 		}
 		if _, ok := cache[f]; !ok {
 			trailing := ""
 			if file.IsDir() {
 				trailing = "/"
 			}
-			links = append(links, Link{f, getUrl(r, path) + f + trailing})
+			if len(title) == 0 {
+				title = humanize(f)
+			}
+			links = append(links, Link{
+				Title:   title,
+				Path:    getUrl(r, path) + f + trailing,
+				Date:    date,
+				Summary: summary,
+				Author:  author,
+				Tags:    tags,
+				Pinned:  pinned,
+			})
 			cache[f] = true
 		}
 	}
 	return links, nil
 }
 
+// Words kept in a listing's summary of a page
+const summaryWords = 30
+
+// Summarize a page for a listing, by its description or the start of its text
+func pageSummary(r *http.Request, base string, f map[string]interface{}) string {
+	if d, ok := f["description"].(string); ok {
+		return d
+	}
+	for _, ext := range pageExts() {
+		fm, body, err := readPage(r, base+ext)
+		if err != nil {
+			continue
+		}
+		words := strings.Fields(plainText(string(renderBody(r, ext, fm, body))))
+		if len(words) > summaryWords {
+			return strings.Join(words[:summaryWords], " ") + "…"
+		}
+		return strings.Join(words, " ")
+	}
+	return ""
+}
+
 // Open the actual markdown files for service
 // This attempts to open any file it possibly can to prevent
 // later loaders from taking over
-func loadPage(path string) (template.HTML, map[string]interface{}, error) {
+// Each of the -pageExt extensions is tried in order
+func loadPage(r *http.Request, path string) (template.HTML, map[string]interface{}, error) {
 	if len(path) == 0 {
 		path = filepath.Join(path, "index")
 	} else if path[len(path)-1:] == "/" {
 		// strip off / in case there's a .md one dir up
 		path = path[:len(path)-1]
-	} else if len(path) > 3 && path[len(path)-3:] == ".md" {
-		path = path[:len(path)-3]
+	} else {
+		path = trimPageExt(path)
 	}
-	filename := path + ".md"
-	fileContents, err := os.ReadFile(filename)
-	if err != nil {
-		return "", nil, errors.New("Page not found: " + path)
+	patterns := ignorePatterns(getPubRoot(r))
+	for _, ext := range pageExts() {
+		if ignored(patterns, getPubRoot(r), path+ext, false) {
+			continue
+		}
+		f, body, err := readPage(r, path+ext)
+		if errors.Is(err, errFrontMatter) {
+			return "", nil, err
+		}
+		if err != nil {
+			continue
+		}
+		html := renderBody(r, ext, f, body)
+		if *inlineSVG {
+			html = template.HTML(inlineSVGs(getPubRoot(r), filepath.Dir(path), []byte(html)))
+		}
+		if *inlineLimit > 0 {
+			html = template.HTML(inlineImages(getPubRoot(r), filepath.Dir(path), []byte(html), *inlineLimit))
+		}
+		if *lazyLoad {
+			html = template.HTML(lazyImages([]byte(html)))
+		}
+		return html, f, nil
+	}
+	return "", nil, errors.New("Page not found: " + path)
+}
+
+// Turn a page body into HTML based on its source extension
+// Plain text is shown as-is, everything else is treated as markdown
+func renderBody(r *http.Request, ext string, f map[string]interface{}, body string) template.HTML {
+	if ext == ".txt" {
+		return template.HTML("<pre>" + template.HTMLEscapeString(body) + "</pre>")
+	}
+	body = expandShortcodes(r, body)
+	shift := *headingShift
+	if s, ok := f["heading_shift"].(int); ok {
+		shift = s
+	}
+	renderer := mermaidRenderer{blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+		Flags:              blackfriday.CommonHTMLFlags,
+		HeadingLevelOffset: shift,
+	})}
+	extensions := blackfriday.CommonExtensions
+	if wantTOC(f) {
+		// the table of contents links to headings by id
+		extensions |= blackfriday.AutoHeadingIDs
+	}
+	// this is blackfriday.Run, but rendering into a pooled buffer
+	md := blackfriday.New(blackfriday.WithRenderer(renderer), blackfriday.WithExtensions(extensions))
+	ast := md.Parse([]byte(body))
+	buf := getBuffer()
+	defer putBuffer(buf)
+	renderer.RenderHeader(buf, ast)
+	ast.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		return renderer.RenderNode(buf, node, entering)
+	})
+	renderer.RenderFooter(buf, ast)
+	return template.HTML(buf.String())
+}
+
+// Get the list of page source extensions, in lookup order
+func pageExts() []string {
+	var exts []string
+	for _, ext := range strings.Split(*pageExt, ",") {
+		ext = strings.TrimSpace(ext)
+		if len(ext) == 0 {
+			continue
+		}
+		if ext[0] != '.' {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
 	}
-	m := front.NewMatter()
-	m.Handle("---", front.YAMLHandler)
-	f, body, err := m.Parse(bytes.NewBuffer(fileContents))
-	html := template.HTML(blackfriday.Run([]byte(body)))
-	return html, f, nil
+	return exts
+}
+
+// Remove a page source extension from a path, if it has one
+func trimPageExt(path string) string {
+	for _, ext := range pageExts() {
+		if len(path) > len(ext) && strings.HasSuffix(path, ext) {
+			return path[:len(path)-len(ext)]
+		}
+	}
+	return path
 }
 
 // Try to load an index.html file, maybe fail
 func htmlIndex(w http.ResponseWriter, r *http.Request) bool {
 	path := getPubPath(r)
 	filename := path + "/index.html"
-	file, err := ioutil.ReadFile(filename)
+	file, err := readFile(filename)
 	if err != nil {
 		return false
 	}
@@ -142,6 +399,18 @@ func htmlIndex(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
+// Answer a missing path with the site's root index.html so a
+// single page app can do its own routing
+func spaIndex(w http.ResponseWriter, r *http.Request) bool {
+	file, err := readFile(filepath.Join(getPubRoot(r), "index.html"))
+	if err != nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(file)
+	return true
+}
+
 // Serve an index of any directory that hasn't been hit yet
 // Note: put an index.md in any directory that should not be
 // globally accessible.
@@ -149,26 +418,90 @@ func dirHandler(w http.ResponseWriter, r *http.Request) {
 	path := getPubPath(r)
 	dir, err := loadDir(r, path)
 	if err != nil {
+		if *spaFallback && spaIndex(w, r) {
+			return
+		}
 		msg := fmt.Sprintf("Could not load %s: File not found", r.URL.Path)
-		http.Error(w, msg, http.StatusNotFound)
-		log.Println(err)
+		renderError(w, r, http.StatusNotFound, msg)
+		logRequest(r, err)
 		return
 	}
 
+	if *zipDownloads && r.URL.Query().Get("download") == "zip" {
+		serveArchive(w, r, path)
+		return
+	}
 	if htmlIndex(w, r) {
 		return
 	}
-	summary, f, err := loadPage(path + "/_index.md")
-	info := NewPageInfo(f)
+	// feed readers may ask for a directory itself as Atom
+	w.Header().Add("Vary", "Accept")
+	if wantsAtom(r) {
+		writeAtom(w, r, collectFeed(r, strings.TrimSuffix(r.URL.Path, "/")+"/"))
+		return
+	}
+	summary, f, err := loadPage(r, path+"/_index")
+	if err != nil && *preferDirs {
+		summary, f, err = loadPage(r, path)
+	}
+	if !checkFrontMatter(w, r, f) {
+		return
+	}
+	listTmpl := pageLayout(r, f, "dir")
+	if listTmpl == "dir" && isGallery(f, dir) && templateExists(r, "gallery") {
+		listTmpl = "gallery"
+	}
+	opts := listingOptions(r, f)
+	// ?combine=1 shows every page of the directory in one, in listing order
+	combine := len(r.URL.Query().Get("combine")) > 0
+	if combine {
+		opts.Per = 0
+	}
+	dir, more := opts.arrange(dir)
+	if opts.Page > 1 && len(dir) == 0 {
+		msg := fmt.Sprintf("Could not load page %d of %s: Page not found", opts.Page, r.URL.Path)
+		renderError(w, r, http.StatusNotFound, msg)
+		return
+	}
+	setCacheControl(w, r, nil)
+	info := NewPageInfo(r, f, siteLocation(r, siteHost(r)))
+	if len(info.Title) == 0 {
+		info.Title = dirTitle(r, r.URL.Path)
+	}
 	info.BreadCrumb = breadCrumb(r.URL.Path)
 	info.Dir = dir
+	if opts.Page > 1 {
+		info.PrevPage = opts.pageURL(r, opts.Page-1)
+	}
+	if more {
+		info.NextPage = opts.pageURL(r, opts.Page+1)
+	}
 	info.Page = summary
-	renderTemplate(w, r, "header", info)
-	if err == nil {
-		renderTemplate(w, r, "view", info)
+	if listTmpl == "gallery" {
+		info.Gallery = galleryImages(dir)
+	}
+	tmpls := []string{"header", "view", listTmpl, "footer"}
+	// summary_below puts _index's prose after the listing it supplements
+	if below, _ := f["summary_below"].(bool); below {
+		tmpls = []string{"header", listTmpl, "view", "footer"}
+	}
+	if err != nil {
+		tmpls = []string{"header", listTmpl, "footer"}
 	}
-	renderTemplate(w, r, "dir", info)
-	renderTemplate(w, r, "footer", info)
+	if combine {
+		info.Page = summary + combinedPages(r, path, dir)
+		tmpls = []string{"header", "view", "footer"}
+	}
+	writePage(w, r, info, tmpls...)
+}
+
+// Name a directory URL after its last element, or the host at the top
+func dirTitle(r *http.Request, dir string) string {
+	dir = strings.Trim(dir, "/")
+	if len(dir) == 0 {
+		return r.Host
+	}
+	return humanize(urlpath.Base(dir))
 }
 
 // Serve any raw files that may be in the directory
@@ -176,69 +509,497 @@ func dirHandler(w http.ResponseWriter, r *http.Request) {
 // This passes through to the dirHandler
 func fileHandler(w http.ResponseWriter, r *http.Request) {
 	path := getPubPath(r)
-	filename := path
-	_, err := ioutil.ReadFile(filename)
-	if err != nil {
+	filename, st, err := resolvePath(path)
+	if err != nil && filepath.Base(path) == "feed.xml" {
+		feedHandler(w, r)
+		return
+	}
+	if err != nil && filepath.Base(path) == "feed.json" {
+		jsonFeedHandler(w, r)
+		return
+	}
+	if err != nil && isSitemap(r.URL.Path) {
+		sitemapHandler(w, r)
+		return
+	}
+	if err != nil && r.URL.Path == "/manifest.json" {
+		manifestHandler(w, r)
+		return
+	}
+	if err != nil && r.URL.Path == "/recent" {
+		recentHandler(w, r)
+		return
+	}
+	if err != nil && r.URL.Path == "/recent.xml" {
+		recentFeedHandler(w, r)
+		return
+	}
+	if err != nil && strings.HasPrefix(r.URL.Path, "/series/") {
+		seriesHandler(w, r)
+		return
+	}
+	if err != nil && len(*missingImage) > 0 && isImage(path) {
+		serveMissingImage(w, r)
+		return
+	}
+	if err == nil && ignored(ignorePatterns(getPubRoot(r)), getPubRoot(r), path, st.IsDir()) {
+		msg := fmt.Sprintf("Could not load %s: File not found", r.URL.Path)
+		renderError(w, r, http.StatusNotFound, msg)
+		return
+	}
+	if err != nil || st.IsDir() {
 		dirHandler(w, r)
 		return
 	}
+	if r.URL.Query().Has("w") && isImage(filename) && serveResized(w, r, filename) {
+		return
+	}
+	if *webpImages && serveWebP(w, r, filename) {
+		return
+	}
+	if typ, ok := mimeType(r, filename); ok {
+		w.Header().Set("Content-Type", typ)
+	}
 	http.ServeFile(w, r, filename)
 }
 
-// Main handler funnction, tries to load any .md pages
+// Main handler funnction, tries to load any page sources (.md by default)
 // This passes through to the fileHandler (and then to dirHandler)
 func pageHandler(w http.ResponseWriter, r *http.Request) {
 	if err := checkDomain(w, r); err != nil {
 		return
 	}
+	if *caseInsensitive && redirectLowercase(w, r) {
+		return
+	}
 	path := getPubPath(r)
-	page, f, err := loadPage(path)
-	if err != nil {
-		page, f, err = loadPage(filepath.Join(path, "index"))
+	// the URL of the directory holding the page source
+	pageDir := urlpath.Dir(strings.TrimSuffix(r.URL.Path, "/"))
+	// permalinks take walking the site, so they're only looked up for paths
+	// with nothing of their own
+	var file string
+	permalink := false
+	if _, _, err := resolvePath(path); err != nil && !pageExists(trimPageExt(path)) {
+		file, permalink = permalinkFile(getPubRoot(r), r.URL.Path)
+	}
+	// blocked.txt may name the page by where its source is
+	if permalink && requestBlocks(r).covers(pageURL(getPubRoot(r), trimPageExt(file))) {
+		blockedPage(w, r)
+		return
+	}
+	if permalink {
+		path = trimPageExt(file)
+		pageDir = pageURL(getPubRoot(r), filepath.Dir(file))
+	}
+	// only extensionless requests are pages, page.md is sent as a file
+	// unless -cleanURLs sends it to page
+	if !permalink && !*cleanURLs && trimPageExt(r.URL.Path) != r.URL.Path {
+		servePageFile(w, r, path)
+		return
+	}
+	var page template.HTML
+	var f map[string]interface{}
+	err := errors.New("directory preferred")
+	// with -preferDirs, dirHandler shows docs.md alongside the docs/ listing
+	if _, st, dirErr := resolvePath(path); permalink || !*preferDirs || dirErr != nil || !st.IsDir() {
+		page, f, err = loadPage(r, path)
+	}
+	if errors.Is(err, errFrontMatter) {
+		renderError(w, r, http.StatusInternalServerError, "Could not read "+r.URL.Path)
+		logRequest(r, path+":", err)
+		return
+	}
+	indexed := err != nil
+	if indexed {
+		page, f, err = loadPage(r, filepath.Join(path, "index"))
 		if err != nil {
 			fileHandler(w, r)
 			return
 		}
+		pageDir = r.URL.Path
+	}
+	if !checkFrontMatter(w, r, f) {
+		return
+	}
+	info := NewPageInfo(r, f, siteLocation(r, siteHost(r)))
+	if !visible(info) && !validPreview(r) {
+		msg := fmt.Sprintf("Could not load %s: File not found", r.URL.Path)
+		renderError(w, r, http.StatusNotFound, msg)
+		return
+	}
+	// a page with a permalink is only served there
+	if len(info.Permalink) > 0 && !permalink {
+		u := *r.URL
+		u.Path = siteURL(r, info.Permalink)
+		u.RawPath = ""
+		http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
+	// with -cleanURLs, /about.md is only served as /about
+	if *cleanURLs && !permalink && !indexed && trimPageExt(r.URL.Path) != r.URL.Path {
+		u := *r.URL
+		u.Path = siteURL(r, trimPageExt(r.URL.Path))
+		u.RawPath = ""
+		http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+		return
 	}
-	info := NewPageInfo(f)
 	info.BreadCrumb = breadCrumb(r.URL.Path)
 	info.Page = page
+	if !fillEmptyPage(w, r, &info, f) {
+		return
+	}
+	// with -rawSource, ?raw=1 sends the markdown the page was rendered from
+	if *rawSource && len(r.URL.Query().Get("raw")) > 0 {
+		if !listed(info) || !serveSource(w, r, sourceBase(path, indexed)) {
+			renderError(w, r, http.StatusNotFound, "Could not load "+r.URL.Path+": No source")
+		}
+		return
+	}
+	if wantTOC(f) {
+		info.TOC = tableOfContents(page, tocDepth(f))
+	}
+	info.Image = resolveAsset(r, pageDir, info.Image)
+	info.Thumbnail = info.Image
+	if len(info.Thumbnail) == 0 {
+		info.Thumbnail = resolveAsset(r, pageDir, firstImage(page))
+	}
+	info.Favicon = resolveAsset(r, pageDir, info.Favicon)
+	info.Author.Avatar = resolveAsset(r, pageDir, info.Author.Avatar)
+	for i := range info.ExtraCSS {
+		info.ExtraCSS[i] = resolveAsset(r, pageDir, info.ExtraCSS[i])
+	}
+	for i := range info.ExtraJS {
+		info.ExtraJS[i] = resolveAsset(r, pageDir, info.ExtraJS[i])
+	}
+	preloadAssets(w, info)
+	info.JSONLD = articleJSONLD(r, info, f)
+	if len(info.Series) > 0 {
+		info.SeriesNav = seriesNav(r, info.Series, r.URL.Path)
+	}
+	setCacheControl(w, r, f)
+	// ?print=1 swaps the site chrome for print.html when the site has one
+	if len(r.URL.Query().Get("print")) > 0 && templateExists(r, "print") {
+		writePage(w, r, info, "print")
+		return
+	}
 	// pass the file into the view template
-	renderTemplate(w, r, "header", info)
-	renderTemplate(w, r, "view", info)
-	renderTemplate(w, r, "footer", info)
+	tmpls := []string{"header", pageLayout(r, f, "view"), "footer"}
+	// pages with comments get the site's comments.html after them
+	if info.Comments && templateExists(r, "comments") {
+		tmpls = []string{"header", tmpls[1], "comments", "footer"}
+	}
+	writePage(w, r, info, tmpls...)
+}
+
+// Send mixed case URLs to their lowercase form so every platform
+// resolves the same files and shows the same breadcrumbs
+// Files are found whatever their case, and only URLs finding one are sent on
+func redirectLowercase(w http.ResponseWriter, r *http.Request) bool {
+	lower := strings.ToLower(r.URL.Path)
+	if lower == r.URL.Path {
+		return false
+	}
+	lr := *r
+	lu := *r.URL
+	lu.Path = lower
+	lr.URL = &lu
+	p := getPubPath(&lr)
+	if _, _, err := resolvePath(p); err != nil && !pageExists(trimPageExt(strings.TrimSuffix(p, "/"))) {
+		return false
+	}
+	u := *r.URL
+	u.Path = siteURL(r, lower)
+	u.RawPath = ""
+	http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+	return true
+}
+
+// Set Cache-Control from -maxAge or the page's cache front matter
+// cache may be seconds or a duration like 1h, and false or 0 forbids caching
+func setCacheControl(w http.ResponseWriter, r *http.Request, f map[string]interface{}) {
+	maxAge := *maxAge
+	// cache: true keeps the -maxAge default, false or 0 mean no caching at all
+	noStore := false
+	switch c := f["cache"].(type) {
+	case bool:
+		noStore = !c
+	case int:
+		maxAge = time.Duration(c) * time.Second
+		noStore = maxAge <= 0
+	case string:
+		d, err := time.ParseDuration(c)
+		if err != nil {
+			logRequest(r, "Ignoring invalid cache", c)
+			break
+		}
+		maxAge = d
+		noStore = maxAge <= 0
+	}
+	if noStore {
+		w.Header().Set("Cache-Control", "no-store")
+	} else if maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	}
+}
+
+// Check whether the site has a template, so optional ones can be skipped
+func templateExists(r *http.Request, tmpl string) bool {
+	_, _, _, err := findTemplate(r, tmpl)
+	return err == nil
+}
+
+// Pick the template a page's layout front matter asks for in place of fallback
+// A layout must name a template of the site, anything else is logged and ignored
+func pageLayout(r *http.Request, f map[string]interface{}, fallback string) string {
+	layout, ok := f["layout"].(string)
+	if !ok || len(layout) == 0 || layout == fallback {
+		return fallback
+	}
+	if !themeName.MatchString(layout) || !templateExists(r, layout) {
+		logRequest(r, "Ignoring invalid layout", layout)
+		return fallback
+	}
+	return layout
 }
 
 // Try to load and execute a template for the given site
-func renderTemplate(w http.ResponseWriter, r *http.Request, tmpl string, data PageInfo) {
-	tPath := filepath.Join(getTmplPath(r), tmpl+"html")
-	tc, ok := templates[tPath]
-	var err error
-	if !ok || tc.ts.Before(time.Now().Add(-*cacheTimeout)) {
-		tc.t, err = template.ParseFiles(filepath.Join(getTmplPath(r), tmpl+".html"))
+func renderTemplate(w io.Writer, r *http.Request, tmpl string, data PageInfo) error {
+	t, err := loadTemplate(r, tmpl)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+// Check whether any of the named templates mention a PageInfo field
+func templatesUse(r *http.Request, tmpls []string, field string) bool {
+	for _, tmpl := range tmpls {
+		t, err := loadTemplate(r, tmpl)
 		if err != nil {
-			http.Error(w, "Could not load templates.", http.StatusInternalServerError)
-			log.Println(err)
-			return
+			continue
 		}
-		templates[tPath] = templateCache{
-			t:  tc.t,
-			ts: time.Now(),
+		for _, at := range t.Templates() {
+			if at.Tree != nil && strings.Contains(at.Tree.Root.String(), "."+field) {
+				return true
+			}
 		}
 	}
-	err = tc.t.Execute(w, data)
+	return false
+}
+
+// Load a template for the given site
+// It comes from the first of getTmplPaths to have it, or the built in theme
+// A cached template is reparsed once it times out or its file changes
+func loadTemplate(r *http.Request, tmpl string) (*template.Template, error) {
+	tPath, filename, st, err := findTemplate(r, tmpl)
 	if err != nil {
-		http.Error(w, "Could not load templates.", http.StatusInternalServerError)
-		log.Println(err)
+		// a site without the template still gets its pages shown
+		t, ok := defaultTemplate(tmpl)
+		if !ok {
+			return nil, err
+		}
+		return t, nil
+	}
+	mod := st.ModTime()
+	templates.RLock()
+	tc, ok := templates.m[tPath]
+	templates.RUnlock()
+	if *noCache || !ok || tc.ts.Before(time.Now().Add(-*cacheTimeout)) || !tc.mod.Equal(mod) {
+		t, err, _ := templates.loads.Do(tPath, func() (interface{}, error) {
+			contents, err := readTemplate(filename)
+			if err != nil {
+				return nil, err
+			}
+			t, err := template.New(filepath.Base(filename)).Parse(string(contents))
+			if err != nil {
+				return nil, err
+			}
+			templates.Lock()
+			templates.m[tPath] = templateCache{
+				t:   t,
+				ts:  time.Now(),
+				mod: mod,
+			}
+			templates.Unlock()
+			return t, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		tc.t = t.(*template.Template)
+	}
+	return tc.t, nil
+}
+
+// Render a page's templates in order and send the result
+// The page is buffered so it can carry a length and an ETag,
+// and so HEAD requests get the headers without the body
+func writePage(w http.ResponseWriter, r *http.Request, info PageInfo, tmpls ...string) {
+	styles, ok := previewStyles(r)
+	if !ok {
+		renderError(w, r, http.StatusBadRequest, "Stylesheet not allowed.")
+		return
+	}
+	// these take walking the site, so only templates showing them get them
+	if *recentCount > 0 && templatesUse(r, tmpls, "Recent") {
+		info.Recent = recentPosts(r)
+	}
+	if templatesUse(r, tmpls, "Featured") {
+		info.Featured = featuredPages(r)
+	}
+	if *treeDepth > 0 {
+		info.Tree = cachedTree(r, getPubRoot(r), *treeDepth)
+	}
+	info.Lang = requestLanguage(r)
+	// the page may differ for signed in users, so don't let caches mix them up
+	if len(loadHostConfig(siteHost(r)).Users) > 0 {
+		w.Header().Add("Vary", "Authorization")
+		info.User, info.Authenticated = requestUser(r)
+		if !info.Authenticated && r.URL.Query().Get("login") == "1" {
+			challengeLogin(w, r)
+			return
+		}
+	}
+	// before mountLinks, since absURL puts the prefixes on itself
+	info.CrumbJSONLD = breadcrumbJSONLD(r, info.BreadCrumb)
+	mountLinks(r, &info)
+	// templates may branch on the query, html/template escapes what they print
+	info.Query = make(map[string]string)
+	for k, v := range r.URL.Query() {
+		info.Query[k] = v[0]
+	}
+	// scripts swapping content in ask for the page without its chrome
+	w.Header().Add("Vary", partialHeader)
+	partial, _ := strconv.ParseBool(r.Header.Get(partialHeader))
+	if partial {
+		tmpls = withoutChrome(tmpls)
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	for _, tmpl := range tmpls {
+		if err := renderTemplate(buf, r, tmpl, info); err != nil {
+			renderError(w, r, http.StatusInternalServerError, "Could not load templates.")
+			logRequest(r, err)
+			return
+		}
+	}
+	body := buf.Bytes()
+	// scripts and styles go on the whole page, not on fragments of it
+	if *liveReload && !partial {
+		body = injectBeforeBodyEnd(body, []byte(liveReloadScript))
+	}
+	if len(styles) > 0 && !partial {
+		body = injectBefore(body, []byte("</head>"), styles)
+	}
+	if *mermaid && !partial && bytes.Contains(body, []byte(mermaidClass)) {
+		body = injectBeforeBodyEnd(body, []byte(mermaidScript))
+	}
+	if snippet := injectSnippet(r, *headInject); len(snippet) > 0 && !partial {
+		body = injectAfterHeadStart(body, snippet)
+	}
+	if snippet := injectSnippet(r, *bodyInject); len(snippet) > 0 && !partial {
+		body = injectBeforeBodyEnd(body, snippet)
+	}
+	// each encoding of the page gets its own ETag so caches never mix them up
+	encoding := negotiateEncoding(r)
+	sum := sha256.Sum256(body)
+	etag := hex.EncodeToString(sum[:8])
+	if len(encoding) > 0 {
+		etag += "-" + encoding
+	}
+	etag = `"` + etag + `"`
+	if *compress {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	w.Header().Set("ETag", etag)
+	status := http.StatusOK
+	if info.Status != 0 {
+		status = info.Status
+	}
+	if status == http.StatusOK && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if len(encoding) > 0 {
+		key := responseKey(r, etag)
+		if compressed, ok := cacheGet(key); ok {
+			body = compressed
+		} else {
+			zbuf := getBuffer()
+			defer putBuffer(zbuf)
+			if err := compressTo(zbuf, body, encoding); err != nil {
+				renderError(w, r, http.StatusInternalServerError, "Could not compress page.")
+				logRequest(r, err)
+				return
+			}
+			body = zbuf.Bytes()
+			cachePut(r, key, body)
+		}
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(body)
 	}
 }
 
+// Buffers for rendering, shared between requests to save allocations
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// Return a buffer to the pool, unless it grew too big to be worth keeping
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > 1<<20 {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// Header asking for just the content of a page
+const partialHeader = "X-Partial"
+
+// Drop the header and footer from a page's templates
+func withoutChrome(tmpls []string) []string {
+	var content []string
+	for _, tmpl := range tmpls {
+		if tmpl != "header" && tmpl != "footer" {
+			content = append(content, tmpl)
+		}
+	}
+	return content
+}
+
+// Put a snippet just before </body>, or at the end without one
+func injectBeforeBodyEnd(page, snippet []byte) []byte {
+	return injectBefore(page, []byte("</body>"), snippet)
+}
+
+// Put a snippet just before the last tag, or at the end without one
+func injectBefore(page, tag, snippet []byte) []byte {
+	i := bytes.LastIndex(page, tag)
+	if i < 0 {
+		return append(page, snippet...)
+	}
+	out := make([]byte, 0, len(page)+len(snippet))
+	out = append(out, page[:i]...)
+	out = append(out, snippet...)
+	return append(out, page[i:]...)
+}
+
 // Check for requisite domain files, if none exist, redirect to an error page
 func checkDomain(w http.ResponseWriter, r *http.Request) error {
-	if _, err := os.Stat(filepath.Join(r.Host, "pub")); err != nil {
+	if _, _, err := resolvePath(filepath.Join(siteHost(r), "pub")); err != nil {
 		goto errpage
 	}
-	if _, err := os.Stat(filepath.Join(r.Host, "templates")); err != nil {
+	if _, _, err := resolvePath(filepath.Join(siteHost(r), "templates")); err != nil && !*defaultTheme {
 		goto errpage
 	}
 	return nil
@@ -249,60 +1010,480 @@ errpage:
 		http.Error(w, "Error page unrenderable", http.StatusInternalServerError)
 		return errors.New("terrible failure")
 	}
-	t.Execute(w, r.Host)
+	// the hosts served are only given away with -showHosts
+	var hosts []string
+	if *showHosts {
+		hosts = listHosts()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	t.Execute(w, struct {
+		Host  string
+		Path  string
+		Hosts []string
+	}{r.Host, r.URL.Path, hosts})
 	return errors.New("domain not found")
 }
 
 // Extract url from local file path
 func getUrl(r *http.Request, path string) string {
-	return strings.Replace(path, r.Host+"/pub", "", 1) + "/"
+	return strings.Replace(path, siteHost(r)+"/pub", "", 1) + "/"
+}
+
+// Turn an asset reference from front matter into an absolute URL
+// Relative references are taken from dir, the URL of the page's directory
+func resolveAsset(r *http.Request, dir, ref string) string {
+	if len(ref) == 0 || strings.Contains(ref, ":") {
+		return ref
+	}
+	if strings.HasPrefix(ref, "//") {
+		return requestScheme(r) + ":" + ref
+	}
+	if ref[0] != '/' {
+		ref = urlpath.Join(dir, ref)
+	}
+	return absURL(r, ref)
+}
+
+// Make an absolute URL on the request's host
+func absURL(r *http.Request, path string) string {
+	return requestScheme(r) + "://" + r.Host + siteURL(r, path)
+}
+
+// Get the scheme the request was made with
+// -scheme overrides it, and with -trustProxy so does X-Forwarded-Proto
+func requestScheme(r *http.Request) string {
+	if len(*scheme) > 0 {
+		return *scheme
+	}
+	if *trustProxy {
+		switch proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto {
+		case "http", "https":
+			return proto
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
 }
 
 // Take URL path and return local public path (based on hostname)
 func getPubPath(r *http.Request) string {
-	return filepath.Join(r.Host, "/pub", r.URL.Path)
+	if p, ok := languagePath(r); ok {
+		return p
+	}
+	return filepath.Join(siteHost(r), "/pub", r.URL.Path)
 }
 
-// Take URL path and return local template path (based on hostname)
-func getTmplPath(r *http.Request) string {
-	return filepath.Join(r.Host, "/templates/")
+// Return the local public directory for the request's host
+func getPubRoot(r *http.Request) string {
+	return filepath.Join(siteHost(r), "/pub")
+}
+
+// Take URL path and return the local template paths (based on hostname)
+// to look for a template in, most specific first:
+// templates/dirs/<dir> for the URL's directory and each one above it,
+// then the theme from ?theme= or -theme, a subdirectory of the templates,
+// then the templates themselves
+func getTmplPaths(r *http.Request) []string {
+	base := filepath.Join(siteHost(r), "/templates/")
+	var paths []string
+	dir := r.URL.Path
+	if !strings.HasSuffix(dir, "/") {
+		dir = urlpath.Dir(dir)
+	}
+	for dir = strings.Trim(dir, "/"); len(dir) > 0 && dir != "."; dir = urlpath.Dir(dir) {
+		paths = append(paths, filepath.Join(base, "dirs", filepath.FromSlash(dir)))
+	}
+	name := r.URL.Query().Get("theme")
+	if len(name) == 0 {
+		name = *theme
+	}
+	if len(name) > 0 && themeName.MatchString(name) {
+		paths = append(paths, filepath.Join(base, name))
+	}
+	return append(paths, base)
+}
+
+// Find the most specific template file for tmpl
+// Without one, the error is from the last place looked
+func findTemplate(r *http.Request, tmpl string) (string, string, fs.FileInfo, error) {
+	var err error
+	for _, p := range getTmplPaths(r) {
+		tPath := filepath.Join(p, tmpl+".html")
+		filename, st, resolveErr := resolvePath(tPath)
+		if resolveErr == nil {
+			return tPath, filename, st, nil
+		}
+		err = resolveErr
+	}
+	return "", "", nil, err
 }
 
 var addr = flag.String("addr", "0.0.0.0:6969", "Where")
+var socket = flag.String("socket", "", "listen on this Unix socket instead of -addr")
 var cacheTimeout = flag.Duration("cacheTimeout", time.Minute, "cache timeout duration")
+var inlineLimit = flag.Int64("inlineImages", 0, "inline local images up to this many bytes as data URIs (0 disables)")
+var strictFrontMatter = flag.Bool("strictFrontMatter", false, "warn on unknown front matter keys and fail on mistyped ones")
+var checkLinksOnly = flag.Bool("checkLinks", false, "check every page for broken internal links and exit")
+var checkTemplates = flag.Bool("validateTemplates", false, "parse every host's templates at startup and exit if any are broken")
+var compress = flag.Bool("compress", true, "compress pages with brotli or gzip for clients that accept them")
+var mimeTypes = flag.String("mimeTypes", "", "comma separated ext=type content types, overriding the built in ones")
+var suggestions = flag.Int("suggestions", 3, "maximum number of similar pages suggested on a 404 (0 for none)")
+var assetsPrefix = flag.String("assetsPrefix", "/assets/", "URL prefix serving each host's assets directory")
+var assetsMaxAge = flag.Duration("assetsMaxAge", 365*24*time.Hour, "Cache-Control max-age for assets (0 sends none)")
+var maxHeaderBytes = flag.Int("maxHeaderBytes", http.DefaultMaxHeaderBytes, "largest request headers accepted, in bytes")
+var maxBodyBytes = flag.Int64("maxBodyBytes", 1<<20, "largest request body handlers will read, in bytes")
+var inlineSVG = flag.Bool("inlineSVG", false, "replace images of local SVGs with the SVG, stripped of scripts")
+var noCache = flag.Bool("noCache", false, "reload templates and pages on every request, for development")
+var toc = flag.Bool("toc", false, "build a table of contents from the headings of every page")
+var defaultTOCDepth = flag.Int("tocDepth", 3, "heading levels a table of contents goes down")
+var scheme = flag.String("scheme", "", "scheme for absolute URLs, instead of the one requests arrive with")
+var trustProxy = flag.Bool("trustProxy", false, "trust X-Forwarded-Proto from a proxy in front of wurk")
+var mountsFile = flag.String("mounts", "", "file of \"host/prefix site\" lines serving sites under path prefixes")
+var dirSummaries = flag.Bool("dirSummaries", false, "list pages in directories by title with a summary of each")
+var strictShortcodes = flag.Bool("strictShortcodes", false, "show an error in place of unknown or broken shortcodes instead of leaving them be")
+var webpImages = flag.Bool("webp", false, "serve JPEG and PNG images as WebP to clients that accept it, when smaller")
+var cacheDir = flag.String("cacheDir", "", "keep resized, converted and compressed files in this directory")
+var zipDownloads = flag.Bool("zipDownloads", false, "let ?download=zip fetch a directory and everything below it as a zip")
+var zipMaxFiles = flag.Int("zipMaxFiles", 1000, "most files a ?download=zip archive may hold")
+var zipMaxBytes = flag.Int64("zipMaxBytes", 100<<20, "most bytes of files a ?download=zip archive may hold")
+var cacheSize = flag.Int64("cacheSize", 100<<20, "bytes -cacheDir may hold before the least recently used files go")
+var mermaid = flag.Bool("mermaid", false, "add the mermaid script to pages with mermaid diagrams")
+var showHosts = flag.Bool("showHosts", false, "list the hosts served on the page for hosts that aren't")
+var accessLog = flag.Bool("accessLog", false, "log every request, including those also in a host's access_log")
+var allowedStyles = flag.String("allowedStyles", "", "comma separated stylesheets a request may add with ?css=")
+var missingImage = flag.String("missingImage", "", "image file to serve in place of missing images")
+var missingImageStatus = flag.Int("missingImageStatus", http.StatusNotFound, "status to send with -missingImage")
+var ignore = flag.String("ignore", "", "comma separated globs of files to hide, like *.draft.md or tmp/")
+var defaultTheme = flag.Bool("defaultTheme", false, "use built in templates for sites missing their own")
+var preferDirs = flag.Bool("preferDirs", false, "list docs/ for /docs with docs.md standing in for a missing _index")
+var cleanURLs = flag.Bool("cleanURLs", false, "redirect requests for page sources like /about.md to /about")
+var treeDepth = flag.Int("treeDepth", 0, "levels of the site every page gets as Tree (0 for none)")
+var timezone = flag.String("timezone", "Local", "time zone for dates without an offset, like UTC or Europe/Paris")
+var comments = flag.Bool("comments", false, "show comments.html after pages without comments front matter")
+var languages = flag.String("languages", "", "comma separated languages, like en,fr, whose /fr/ paths are served from pub/fr first")
+var sitemapSize = flag.Int("sitemapSize", 50000, "most pages in one sitemap before it's split up behind /sitemap_index.xml")
+var countryHeader = flag.String("countryHeader", "CF-IPCountry", "request header holding the client's country code, for blocked.txt")
+var emptyPages = flag.String("emptyPages", "render", "what to do with pages that are only front matter: render, 404, placeholder or meta")
+var emptyPlaceholder = flag.String("emptyPlaceholder", "Nothing here yet.", "text shown on pages that are only front matter with -emptyPages=placeholder")
+var headInject = flag.String("headInject", "", "file whose contents go just after <head> on every page, like analytics")
+var bodyInject = flag.String("bodyInject", "", "file whose contents go just before </body> on every page, like a banner script")
+var rawSource = flag.Bool("rawSource", false, "send the source of listed pages for ?raw=1")
+var rawFrontMatter = flag.Bool("rawFrontMatter", false, "keep the front matter in page sources sent for ?raw=1")
+var caseInsensitive = flag.Bool("caseInsensitive", false, "find files whatever the case of their names, redirecting URLs with capitals in them to their lowercase form")
+var showDrafts = flag.Bool("drafts", false, "serve and list draft and expired pages")
+var rootList = flag.String("roots", ".", "comma separated content roots holding host directories, searched in order")
+var liveReload = flag.Bool("liveReload", false, "reload browsers when content changes, for development")
+var feedLimit = flag.Int("feedLimit", 20, "maximum number of items in a feed (0 for no limit)")
+var recentCount = flag.Int("recentPosts", 5, "number of dated pages every page gets as Recent (0 for none)")
+var recentLimit = flag.Int("recentLimit", 20, "maximum number of pages at /recent and /recent.xml (0 for no limit)")
+var maxAge = flag.Duration("maxAge", 0, "Cache-Control max-age for rendered pages (0 sends none)")
+var previewSecret = flag.String("previewSecret", "", "secret for signing ?preview= links to unpublished pages")
+var signPreview = flag.String("signPreview", "", "print a preview link for this URL path and exit")
+var previewTTL = flag.Duration("previewTTL", 0, "how long links from -signPreview work (0 for forever)")
+var spaFallback = flag.Bool("spaFallback", false, "serve the root index.html instead of a 404 for missing paths")
+var lazyLoad = flag.Bool("lazyImages", true, "add loading=lazy and decoding=async to images in pages")
+var headingShift = flag.Int("headingShift", 0, "render markdown headings this many levels lower, so # becomes <h2> with 1")
+var theme = flag.String("theme", "", "serve templates from this subdirectory of each host's templates")
+var thumbWidth = flag.Int("thumbWidth", 300, "width of gallery thumbnails")
+var resizeWidths = flag.String("resizeWidths", "", "comma separated widths images may be scaled to with ?w=, besides -thumbWidth")
+var pageExt = flag.String("pageExt", ".md", "comma separated page source extensions, tried in order")
 
 func main() {
 	flag.Parse()
-	http.HandleFunc("/", pageHandler)
+	if len(*signPreview) > 0 {
+		if len(*previewSecret) == 0 {
+			log.Fatal("-signPreview needs a -previewSecret")
+		}
+		var expiry time.Time
+		if *previewTTL > 0 {
+			expiry = time.Now().Add(*previewTTL)
+		}
+		fmt.Println(*signPreview + "?preview=" + previewToken(*signPreview, expiry))
+		return
+	}
+	if *checkLinksOnly {
+		broken := checkAllLinks()
+		for _, b := range broken {
+			log.Println(b)
+		}
+		if len(broken) > 0 {
+			log.Fatalf("Found %d broken links", len(broken))
+		}
+		log.Println("No broken links found")
+		return
+	}
+	if *checkTemplates {
+		problems := validateTemplates()
+		for _, p := range problems {
+			log.Println(p)
+		}
+		if len(problems) > 0 {
+			log.Fatalf("Found %d broken templates", len(problems))
+		}
+	}
+	for _, name := range []string{*headInject, *bodyInject} {
+		if _, err := os.Stat(name); len(name) > 0 && err != nil {
+			log.Fatal(err)
+		}
+	}
+	if !emptyPageModes[*emptyPages] {
+		log.Fatalf("Unknown -emptyPages %q", *emptyPages)
+	}
+	if _, err := loadLocation(*timezone); err != nil {
+		log.Fatal(err)
+	}
+	if len(*mountsFile) > 0 {
+		var err error
+		if mounts, err = loadMounts(*mountsFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", readOnly(pageHandler))
+	mux.Handle("/search-index.json", readOnly(searchIndexHandler))
+	mux.Handle(assetsURL(), readOnly(assetHandler))
+	mux.Handle("/bundle.css", readOnly(bundleHandler))
+	mux.Handle("/bundle.js", readOnly(bundleHandler))
+	if *liveReload {
+		if _, err := watchContent(); err != nil {
+			log.Fatal(err)
+		}
+		mux.Handle(liveReloadPath, readOnly(websocket.Handler(liveReloadHandler).ServeHTTP))
+	}
+	srv := &http.Server{
+		Addr:           *addr,
+		Handler:        withRequestID(withMounts(withLanguages(logAccess(recoverPanics(limitBody(withBlocks(mux))))))),
+		MaxHeaderBytes: *maxHeaderBytes,
+	}
+	if len(*socket) > 0 {
+		l, err := listenUnix(*socket)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Listening on unix:" + *socket)
+		log.Fatal(srv.Serve(l))
+	}
 	log.Println("Listening on http://" + *addr)
-	log.Fatal(http.ListenAndServe(*addr, nil))
+	log.Fatal(srv.ListenAndServe())
 }
 
-func init() {
-	templates = make(map[string]templateCache)
+// Listen on a Unix socket, clearing out one left behind by a previous run
+func listenUnix(path string) (net.Listener, error) {
+	if st, err := os.Lstat(path); err == nil && st.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
 }
 
-func NewPageInfo(f map[string]interface{}) PageInfo {
-	t := time.Now()
+// Read a page's front matter into PageInfo
+// Dates and times without an offset are taken to be in loc, and shown there
+func NewPageInfo(r *http.Request, f map[string]interface{}, loc *time.Location) PageInfo {
+	t := time.Now().In(loc)
 	pi := PageInfo{
 		RawDate: t,
 		Date:    "",
 		Time:    "",
 	}
-	if t, ok := f["time"]; ok {
-		pi.Time = t.(string)
+	if t, ok := f["time"].(string); ok {
+		pi.Time = t
 	}
-	if d, ok := f["date"]; ok {
-		pi.Date = d.(string)
+	d, dated := f["date"].(string)
+	if dated {
+		pi.Date = d
+		if raw, ok := parseDate(pi.Date, loc); ok {
+			pi.RawDate = raw
+		}
 	} else {
 		pi.Date = t.Format(time.DateOnly)
 		pi.Time = t.Format("15:04")
 	}
-	if a, ok := f["author"]; ok {
-		pi.Author = a.(string)
+	if tm, ok := f["time"].(string); ok {
+		setTime(&pi, tm, dated, loc)
+	}
+	switch a := f["author"].(type) {
+	case string:
+		pi.Author.Name = a
+	case map[interface{}]interface{}:
+		pi.Author.Name, _ = a["name"].(string)
+		pi.Author.URL, _ = a["url"].(string)
+		pi.Author.Avatar, _ = a["avatar"].(string)
+	}
+	if u, ok := f["author_url"].(string); ok {
+		pi.Author.URL = u
+	}
+	if t, ok := f["title"].(string); ok {
+		pi.Title = t
+	}
+	if d, ok := f["description"].(string); ok {
+		pi.Description = d
+	}
+	if tags, ok := f["tags"].([]interface{}); ok {
+		for _, t := range tags {
+			pi.Tags = append(pi.Tags, fmt.Sprint(t))
+		}
+	}
+	if css, ok := f["css"].([]interface{}); ok {
+		for _, c := range css {
+			pi.ExtraCSS = append(pi.ExtraCSS, fmt.Sprint(c))
+		}
+	}
+	if js, ok := f["js"].([]interface{}); ok {
+		for _, j := range js {
+			pi.ExtraJS = append(pi.ExtraJS, fmt.Sprint(j))
+		}
+	}
+	for _, key := range []string{"class", "body_class"} {
+		if c, ok := f[key].(string); ok {
+			pi.BodyClass = classNames(c)
+		}
+	}
+	if robots, ok := f["robots"].(string); ok {
+		pi.Robots = robots
+	}
+	if p, err := sitemapPriority(f); err == nil {
+		pi.SitemapPriority = strconv.FormatFloat(p, 'f', -1, 64)
+	}
+	if c, err := sitemapChangefreq(f); err == nil {
+		pi.SitemapChangefreq = c
+	}
+	pi.Comments = *comments
+	if c, ok := f["comments"].(bool); ok {
+		pi.Comments = c
 	}
-	if t, ok := f["title"]; ok {
-		pi.Title = t.(string)
+	if p, ok := f["pinned"].(bool); ok {
+		pi.Pinned = p
+	}
+	if ft, ok := f["featured"].(bool); ok {
+		pi.IsFeatured = ft
+	}
+	if d, ok := f["draft"].(bool); ok {
+		pi.Draft = d
+	}
+	if h, ok := f["hidden"].(bool); ok {
+		pi.Hidden = h
+	}
+	if e, ok := f["expires"].(string); ok {
+		if exp, ok := parseDate(e, loc); ok {
+			pi.Expires = exp
+		} else {
+			logRequest(r, "Ignoring invalid expires", e)
+		}
+	}
+	if i, ok := f["image"].(string); ok {
+		pi.Image = i
+	}
+	if i, ok := f["favicon"].(string); ok {
+		pi.Favicon = i
+	}
+	if s, ok := f["series"].(string); ok {
+		pi.Series = s
+	}
+	if w, ok := f["weight"].(int); ok {
+		pi.Weight = w
+	}
+	if p, ok := f["permalink"].(string); ok && len(p) > 0 {
+		pi.Permalink = urlpath.Join("/", p)
+		if strings.HasSuffix(p, "/") && pi.Permalink != "/" {
+			pi.Permalink += "/"
+		}
+	}
+	// status lets a page such as 410.md answer with its own HTTP code
+	// Codes that can't carry the page, 1xx, 204 and 304, are refused
+	if s, ok := f["status"].(int); ok {
+		if s >= 200 && s <= 599 && s != http.StatusNoContent && s != http.StatusNotModified {
+			pi.Status = s
+		} else {
+			logRequest(r, "Ignoring invalid status", s)
+		}
 	}
 	return pi
 }
+
+// Keep just the class names made of letters, digits, - and _
+func classNames(s string) string {
+	var names []string
+	for _, name := range strings.Fields(s) {
+		if className.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// Fold a time front matter value into a page's RawDate and Time
+// A full RFC3339 timestamp stands in for a missing date, while a clock time
+// like 14:30 or 14:30+02:00 is only put on the date the page gives
+// Times with an offset are shown in loc
+func setTime(pi *PageInfo, tm string, dated bool, loc *time.Location) {
+	if ts, err := time.Parse(time.RFC3339, tm); err == nil {
+		if dated {
+			y, m, d := pi.RawDate.Date()
+			ts = time.Date(y, m, d, ts.Hour(), ts.Minute(), ts.Second(), 0, ts.Location())
+		} else {
+			pi.Date = ts.In(loc).Format(time.DateOnly)
+		}
+		pi.RawDate = ts
+		pi.Time = ts.In(loc).Format("15:04")
+		return
+	}
+	for _, layout := range []string{"15:04", "15:04:05", "15:04Z07:00", "15:04:05Z07:00"} {
+		clock, err := time.Parse(layout, tm)
+		if err != nil {
+			continue
+		}
+		pi.Time = clock.Format("15:04")
+		if dated {
+			zone := pi.RawDate.Location()
+			if strings.HasSuffix(layout, "Z07:00") {
+				zone = clock.Location()
+			}
+			y, m, d := pi.RawDate.Date()
+			pi.RawDate = time.Date(y, m, d, clock.Hour(), clock.Minute(), clock.Second(), 0, zone)
+			pi.Time = pi.RawDate.In(loc).Format("15:04")
+		}
+		return
+	}
+}
+
+// Whether front matter dates a page, with a date or a full timestamp for time
+func hasDate(f map[string]interface{}) bool {
+	if _, ok := f["date"]; ok {
+		return true
+	}
+	tm, _ := f["time"].(string)
+	_, err := time.Parse(time.RFC3339, tm)
+	return err == nil
+}
+
+// Dates in front matter may be a plain day or a full timestamp
+func parseDate(s string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range []string{time.DateOnly, "2006-01-02 15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Whether a page should be served and listed
+// Drafts and expired pages are only shown with -drafts
+func visible(pi PageInfo) bool {
+	if *showDrafts {
+		return true
+	}
+	if pi.Draft {
+		return false
+	}
+	return pi.Expires.IsZero() || time.Now().Before(pi.Expires)
+}
+
+// Whether a page should show up in listings, feeds and search
+// Hidden pages are served but only found by those who know the way
+func listed(pi PageInfo) bool {
+	return visible(pi) && !pi.Hidden
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrontMatterStatus(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/gone.md": "---\ntitle: Gone\nstatus: 410\n---\nThis page has moved on.",
+	})
+	w := getPage("/gone")
+	if w.Code != http.StatusGone {
+		t.Errorf("got status %d, want 410", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "This page has moved on.") {
+		t.Errorf("410 page lost its body: %q", w.Body.String())
+	}
+	logged := captureLog(t)
+	for _, s := range []int{100, 204, 304, 600} {
+		pi := NewPageInfo(nil, map[string]interface{}{"status": s}, time.UTC)
+		if pi.Status != 0 {
+			t.Errorf("status %d accepted", s)
+		}
+	}
+	if n := strings.Count(logged.String(), "Ignoring invalid status"); n != 4 {
+		t.Errorf("%d of 4 bad statuses logged: %s", n, logged)
+	}
+	if pi := NewPageInfo(nil, map[string]interface{}{"status": 200}, time.UTC); pi.Status != 200 {
+		t.Errorf("status 200 refused")
+	}
+}
+
+func TestTextPage(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/notes.txt": "a <b> *not emphasis*",
+	})
+	setFlag(t, pageExt, ".md,.txt")
+	w := getPage("/notes")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	if want := "<v><pre>a &lt;b&gt; *not emphasis*</pre></v>"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("got %q, want it to contain %q", w.Body.String(), want)
+	}
+}
+
+func TestPageExtFiles(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/robots.txt": "User-agent: *\nDisallow:\n",
+		"h/pub/draft.md":   "---\ndraft: true\n---\nsecret",
+		"h/pub/ok.md":      "---\ntitle: OK\n---\nfine",
+		"h/pub/empty.md":   "---\ntitle: Empty\n---\n",
+	})
+	setFlag(t, pageExt, ".md,.txt")
+	w := getPage("/robots.txt")
+	if w.Code != http.StatusOK || w.Body.String() != "User-agent: *\nDisallow:\n" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("robots.txt got status %d as %q: %q", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if w := getPage("/ok.md"); w.Body.String() != "fine" {
+		t.Errorf("page source got %q", w.Body.String())
+	}
+	if w := getPage("/draft.md"); w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("draft source got status %d: %q", w.Code, w.Body.String())
+	}
+	if w := getPage("/missing.txt"); w.Code != http.StatusNotFound {
+		t.Errorf("missing file got status %d", w.Code)
+	}
+	setFlag(t, emptyPages, "404")
+	if w := getPage("/empty.md"); w.Code != http.StatusNotFound {
+		t.Errorf("empty source got status %d with -emptyPages=404", w.Code)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/about.md": "about"})
+	setFlag(t, caseInsensitive, true)
+	if w := getPage("/about"); w.Code != http.StatusOK {
+		t.Errorf("lowercase path got status %d", w.Code)
+	}
+	w := getPage("/About?x=1")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/about?x=1" {
+		t.Errorf("mixed case path got status %d to %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestCaseInsensitiveFiles(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/About.md":      "about",
+		"h/pub/Docs/Logo.PNG": "png",
+		"h/pub/Docs/Guide.md": "guide",
+	})
+	setFlag(t, caseInsensitive, true)
+	w := getPage("/About")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/about" {
+		t.Errorf("mixed case page got status %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := getPage("/about"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "about") {
+		t.Errorf("page with capitals got status %d: %s", w.Code, w.Body.String())
+	}
+	if w := getPage("/docs/logo.png"); w.Code != http.StatusOK || w.Body.String() != "png" {
+		t.Errorf("file with capitals got status %d: %s", w.Code, w.Body.String())
+	}
+	if w := getPage("/docs/"); !strings.Contains(w.Body.String(), "Guide") {
+		t.Errorf("directory with capitals not listed: %s", w.Body.String())
+	}
+	if w := getPage("/Missing"); w.Code != http.StatusNotFound {
+		t.Errorf("missing mixed case path got status %d", w.Code)
+	}
+}
+
+func TestUnknownHost(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a"})
+	r := hostRequest("/a")
+	r.Host = "elsewhere"
+	w := httptest.NewRecorder()
+	pageHandler(w, r)
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "<li>h</li>") {
+		t.Errorf("unknown host got status %d: %s", w.Code, w.Body.String())
+	}
+	setFlag(t, showHosts, true)
+	w = httptest.NewRecorder()
+	pageHandler(w, r)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "<li>h</li>") {
+		t.Errorf("-showHosts got status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExpires(t *testing.T) {
+	yesterday := time.Now().AddDate(0, 0, -1).Format(time.DateOnly)
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+	newSite(t, map[string]string{
+		"h/pub/old.md": "---\nexpires: " + yesterday + "\n---\nold",
+		"h/pub/new.md": "---\nexpires: " + tomorrow + "\n---\nnew",
+	})
+	if w := getPage("/old"); w.Code != http.StatusNotFound {
+		t.Errorf("expired page got status %d", w.Code)
+	}
+	if w := getPage("/new"); w.Code != http.StatusOK {
+		t.Errorf("unexpired page got status %d", w.Code)
+	}
+	if got := strings.Join(listingTitles(getPage("/").Body.String()), ","); got != "New" {
+		t.Errorf("listing has %s", got)
+	}
+}
+
+func TestHumanize(t *testing.T) {
+	for slug, want := range map[string]string{
+		"my-post":        "My Post",
+		"rest_api-guide": "Rest API Guide",
+		"élan-vital":     "Élan Vital",
+		"json":           "JSON",
+	} {
+		if got := humanize(slug); got != want {
+			t.Errorf("humanize(%q) = %q, want %q", slug, got, want)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "over the socket"})
+	sock := filepath.Join(t.TempDir(), "wurk.sock")
+	l, err := listenUnix(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a socket left behind by an earlier run is cleared away
+	l.Close()
+	if l, err = listenUnix(sock); err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(pageHandler)}
+	go srv.Serve(l)
+	defer srv.Close()
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://" + testHost + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "over the socket") {
+		t.Errorf("got status %d: %q", resp.StatusCode, body)
+	}
+}
+
+func TestCacheFrontMatter(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/seconds.md":  "---\ncache: 60\n---\n",
+		"h/pub/duration.md": "---\ncache: 2h\n---\n",
+		"h/pub/never.md":    "---\ncache: false\n---\n",
+		"h/pub/default.md":  "",
+		"h/pub/on.md":       "---\ncache: true\n---\n",
+		"h/pub/zero.md":     "---\ncache: 0\n---\n",
+	})
+	setFlag(t, maxAge, 5*time.Minute)
+	for page, want := range map[string]string{
+		"/seconds":  "max-age=60",
+		"/duration": "max-age=7200",
+		"/never":    "no-store",
+		"/default":  "max-age=300",
+		"/on":       "max-age=300",
+		"/zero":     "no-store",
+	} {
+		if got := getPage(page).Header().Get("Cache-Control"); got != want {
+			t.Errorf("%s got Cache-Control %q, want %q", page, got, want)
+		}
+	}
+	// with no -maxAge, cache: true leaves the header to the browser's defaults
+	setFlag(t, maxAge, 0)
+	if got := getPage("/on").Header().Get("Cache-Control"); got != "" {
+		t.Errorf("cache: true without -maxAge got Cache-Control %q", got)
+	}
+}
+
+func TestRelativeImage(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/header.html": "<h>{{.Image}}|{{.Favicon}}</h>",
+		"h/pub/blog/2024/post.md": "---\nimage: cover.png\nfavicon: /favicon.ico\n---\n",
+	})
+	body := getPage("/blog/2024/post").Body.String()
+	if want := "<h>http://h/blog/2024/cover.png|http://h/favicon.ico</h>"; !strings.HasPrefix(body, want) {
+		t.Errorf("got %q, want it to start %q", body, want)
+	}
+}
+
+func TestHead(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a"})
+	h := readOnly(pageHandler)
+	get := request(h, http.MethodGet, "/a", nil)
+	head := request(h, http.MethodHead, "/a", nil)
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Errorf("HEAD got status %d and %d bytes", head.Code, head.Body.Len())
+	}
+	for _, name := range []string{"Content-Length", "Content-Type", "ETag"} {
+		if head.Header().Get(name) != get.Header().Get(name) || len(get.Header().Get(name)) == 0 {
+			t.Errorf("HEAD got %s %q, GET %q", name, head.Header().Get(name), get.Header().Get(name))
+		}
+	}
+}
+
+func TestSPAFallback(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/index.html": "<app></app>"})
+	if w := getPage("/some/route"); w.Code != http.StatusNotFound {
+		t.Errorf("without -spaFallback got status %d", w.Code)
+	}
+	setFlag(t, spaFallback, true)
+	w := getPage("/some/route")
+	if w.Code != http.StatusOK || w.Body.String() != "<app></app>" {
+		t.Errorf("got status %d: %q", w.Code, w.Body.String())
+	}
+}
+
+func TestDomainErrorEscapesHost(t *testing.T) {
+	newSite(t, nil)
+	r := httptest.NewRequest(http.MethodGet, "/x", nil)
+	r.Host = "<script>evil"
+	w := httptest.NewRecorder()
+	pageHandler(w, r)
+	body := w.Body.String()
+	if strings.Contains(body, "<script>evil") || !strings.Contains(body, "&lt;script&gt;evil") {
+		t.Errorf("host not escaped: %s", body)
+	}
+	if !strings.Contains(body, testHost) {
+		t.Errorf("configured hosts not listed: %s", body)
+	}
+}
+
+func TestHeadingShift(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md": "# One\n\n###### Six",
+		"h/pub/b.md": "---\nheading_shift: 0\n---\n# One",
+	})
+	setFlag(t, headingShift, 1)
+	body := getPage("/a").Body.String()
+	if !strings.Contains(body, "<h2>One</h2>") || !strings.Contains(body, "<h6>Six</h6>") {
+		t.Errorf("got %s", body)
+	}
+	if body := getPage("/b").Body.String(); !strings.Contains(body, "<h1>One</h1>") {
+		t.Errorf("front matter didn't override the flag: %s", body)
+	}
+}
+
+func BenchmarkWritePage(b *testing.B) {
+	newSite(b, map[string]string{"h/pub/a.md": strings.Repeat("Some *markdown* to render.\n\n", 200)})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if w := getPage("/a"); w.Code != http.StatusOK {
+			b.Fatalf("got status %d", w.Code)
+		}
+	}
+}
+
+func TestPermalink(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/posts/hello.md": "---\ntitle: Hello\npermalink: /2024/01/hello/\n---\nhi",
+	})
+	for _, target := range []string{"/2024/01/hello/", "/2024/01/hello"} {
+		if w := getPage(target); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<p>hi</p>") {
+			t.Errorf("%s got status %d: %q", target, w.Code, w.Body.String())
+		}
+	}
+	w := getPage("/posts/hello?x=1")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/2024/01/hello/?x=1" {
+		t.Errorf("file path got status %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if pages := sitePages(hostRequest("/")); len(pages) != 1 || pages[0].URL != "/2024/01/hello/" {
+		t.Errorf("site lists %+v", pages)
+	}
+}
+
+func TestPrintView(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a"})
+	if body := getPage("/a?print=1").Body.String(); !strings.HasPrefix(body, "<h></h><v>") {
+		t.Errorf("without print.html got %q", body)
+	}
+	newSite(t, map[string]string{
+		"h/templates/print.html": "<print>{{.Page}}</print>",
+		"h/pub/a.md":             "a",
+	})
+	if body := getPage("/a?print=1").Body.String(); body != "<print><p>a</p>\n</print>" {
+		t.Errorf("got %q", body)
+	}
+	if body := getPage("/a").Body.String(); !strings.HasPrefix(body, "<h></h><v>") {
+		t.Errorf("without ?print=1 got %q", body)
+	}
+}
+
+func TestQueryInTemplates(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/footer.html": `<f>{{if eq .Query.debug "1"}}debug {{end}}{{.Query.q}}</f>`,
+		"h/pub/a.md":              "a",
+	})
+	for target, want := range map[string]string{
+		"/a":                   "<f></f>",
+		"/a?debug=1&q=%3Cb%3E": "<f>debug &lt;b&gt;</f>",
+	} {
+		if body := getPage(target).Body.String(); !strings.HasSuffix(body, want) {
+			t.Errorf("%s got %q, want it to end %q", target, body, want)
+		}
+	}
+}
+
+func TestScheme(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/header.html": "<h>{{.Image}}</h>",
+		"h/pub/a.md":              "---\nimage: /pic.png\n---\n",
+	})
+	forwarded := map[string]string{"X-Forwarded-Proto": "https"}
+	h := http.HandlerFunc(pageHandler)
+	image := func() string {
+		body := request(h, http.MethodGet, "/a", forwarded).Body.String()
+		return body[len("<h>"):strings.Index(body, "</h>")]
+	}
+	if got := image(); got != "http://h/pic.png" {
+		t.Errorf("untrusted X-Forwarded-Proto gave %q", got)
+	}
+	setFlag(t, trustProxy, true)
+	if got := image(); got != "https://h/pic.png" {
+		t.Errorf("trusted X-Forwarded-Proto gave %q", got)
+	}
+	setFlag(t, scheme, "https")
+	forwarded["X-Forwarded-Proto"] = "http"
+	if got := image(); got != "https://h/pic.png" {
+		t.Errorf("-scheme https gave %q", got)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/view.html": "<v>{{.Thumbnail}}</v>",
+		"h/pub/d/a.md":          "hi\n\n![x](pics/one.png?a=1&b=2)\n\n![y](/two.png)",
+		"h/pub/d/b.md":          "---\nimage: /set.png\n---\n![x](one.png)",
+		"h/pub/d/c.md":          "none",
+	})
+	for target, want := range map[string]string{
+		"/d/a": "<v>http://h/d/pics/one.png?a=1&amp;b=2</v>",
+		"/d/b": "<v>http://h/set.png</v>",
+		"/d/c": "<v></v>",
+	} {
+		if body := getPage(target).Body.String(); !strings.Contains(body, want) {
+			t.Errorf("%s got %q, want it to contain %q", target, body, want)
+		}
+	}
+}
+
+func TestCleanURLs(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/about.md": "about", "h/pub/x.txt": "x"})
+	if w := getPage("/about.md"); w.Code != http.StatusOK {
+		t.Errorf("without -cleanURLs got status %d", w.Code)
+	}
+	setFlag(t, cleanURLs, true)
+	w := getPage("/about.md?a=1")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/about?a=1" {
+		t.Errorf("got status %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	for target, want := range map[string]int{
+		"/about":   http.StatusOK,
+		"/x.txt":   http.StatusOK,
+		"/nope.md": http.StatusNotFound,
+	} {
+		if w := getPage(target); w.Code != want {
+			t.Errorf("%s got status %d, want %d", target, w.Code, want)
+		}
+	}
+}
+
+func TestAuthor(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/templates/view.html": "<v>[{{.Author.Name}}|{{.Author.URL}}|{{.Author.Avatar}}]</v>",
+		"h/pub/d/a.md":          "---\nauthor: Plain\n---\na",
+		"h/pub/d/b.md":          "---\nauthor:\n  name: Obj\n  url: https://o.example\n  avatar: me.png\n---\nb",
+	})
+	for target, want := range map[string]string{
+		"/d/a": "<v>[Plain||]</v>",
+		"/d/b": "<v>[Obj|https://o.example|http://h/d/me.png]</v>",
+	} {
+		if body := getPage(target).Body.String(); !strings.Contains(body, want) {
+			t.Errorf("%s got %q, want it to contain %q", target, body, want)
+		}
+	}
+}
+
+func TestBodyClass(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":            "---\nclass: \"post wide 9bad <script> ok_1\"\n---\na",
+		"h/pub/b.md":            "---\nbody_class: '\"onload=x'\n---\nb",
+		"h/templates/view.html": `<body class="{{.BodyClass}}">`,
+	})
+	for target, want := range map[string]string{
+		"/a": `<body class="post wide ok_1">`,
+		"/b": `<body class="">`,
+	} {
+		if body := getPage(target).Body.String(); !strings.Contains(body, want) {
+			t.Errorf("%s got %q, want %q", target, body, want)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	newSite(t, map[string]string{
+		"h/pub/a.md":                "a",
+		"h/pub/b.md":                "---\ncomments: true\n---\nb",
+		"h/pub/c.md":                "---\ncomments: false\n---\nc",
+		"h/templates/comments.html": "<c>",
+	})
+	for _, on := range []bool{false, true} {
+		setFlag(t, comments, on)
+		for target, want := range map[string]bool{"/a": on, "/b": true, "/c": false} {
+			if body := getPage(target).Body.String(); strings.Contains(body, "<c>") != want {
+				t.Errorf("-comments=%t %s got %q", on, target, body)
+			}
+		}
+	}
+}
+
+func TestPartial(t *testing.T) {
+	newSite(t, map[string]string{"h/pub/a.md": "a", "h/pub/d/b.md": "b"})
+	for _, c := range []struct{ target, partial, want string }{
+		{"/a", "", "<h></h><v><p>a</p>\n</v><f></f>"},
+		{"/a", "true", "<v><p>a</p>\n</v>"},
+		{"/a", "false", "<h></h><v><p>a</p>\n</v><f></f>"},
+		{"/d/", "true", "<d>[B|/d/b]</d>"},
+	} {
+		w := request(http.HandlerFunc(pageHandler), "GET", c.target, map[string]string{"X-Partial": c.partial})
+		if w.Body.String() != c.want {
+			t.Errorf("%s X-Partial: %q got %q, want %q", c.target, c.partial, w.Body.String(), c.want)
+		}
+		if !strings.Contains(strings.Join(w.Header()["Vary"], ","), "X-Partial") {
+			t.Errorf("%s doesn't vary on X-Partial", c.target)
+		}
+	}
+}